@@ -0,0 +1,67 @@
+// Copyright © 2019. Sergey Skaredov.
+// Licensed under the MIT License.
+// See LICENSE.txt for details.
+
+package merlin
+
+import (
+	"encoding"
+	"math/big"
+)
+
+// Typed variants of AppendMessage, each value has a single canonical
+// encoding, which is framed as any message: AD[label || LE32(len(v))](v).
+// Use them instead of ad hoc encodings, so that the same value
+// gives the same transcript in every protocol
+
+// Add u32 encoded as LE32(u32)
+func (t *Transcript) AppendU32(label []byte, u32 uint32) {
+	t.AppendMessage(label, encodeU32(u32))
+}
+
+// Add i64 encoded as LE64 of its two's complement
+func (t *Transcript) AppendI64(label []byte, i64 int64) {
+	t.AppendMessage(label, encodeU64(uint64(i64)))
+}
+
+// Add b encoded as a single byte, 1 for true and 0 for false
+func (t *Transcript) AppendBool(label []byte, b bool) {
+	var v byte
+	if b {
+		v = 1
+	}
+	t.AppendMessage(label, []byte{v})
+}
+
+// Add s encoded as its bytes as is, i.e. UTF-8 for Go strings
+func (t *Transcript) AppendString(label []byte, s string) {
+	t.AppendMessage(label, []byte(s))
+}
+
+// Add x encoded as a sign byte, 0 for x >= 0 and 1 for x < 0,
+// followed by the magnitude |x| in little-endian without trailing
+// zero bytes, so 0 is encoded as the single byte 0.
+// The length of the magnitude is fixed by the LE32 length of the message
+func (t *Transcript) AppendBigInt(label []byte, x *big.Int) {
+	t.AppendMessage(label, encodeBigInt(x))
+}
+
+// Add the result of m.MarshalBinary, returns the marshaling error
+// or ErrBufferTooLarge and leaves the transcript untouched then
+func (t *Transcript) AppendBinaryMarshaler(label []byte, m encoding.BinaryMarshaler) error {
+	data, err := m.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return t.TryAppendMessage(label, data)
+}
+
+func encodeBigInt(x *big.Int) []byte {
+	var sign byte
+	if x.Sign() < 0 {
+		sign = 1
+	}
+	magnitude := x.Bytes()
+	reverse(magnitude)
+	return append([]byte{sign}, magnitude...)
+}
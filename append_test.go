@@ -0,0 +1,82 @@
+// Copyright © 2019. Sergey Skaredov.
+// Licensed under the MIT License.
+// See LICENSE.txt for details.
+
+package merlin
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func assertTranscripts(t *testing.T, t1, t2 *Transcript) {
+	c1, c2 := make([]byte, 32), make([]byte, 32)
+	t1.ChallengeBytes([]byte("challenge"), c1)
+	t2.ChallengeBytes([]byte("challenge"), c2)
+	assert.Equal(t, c1, c2)
+}
+
+func TestAppendTyped(t *testing.T) {
+	t1, t2 := NewTranscript("test protocol"), NewTranscript("test protocol")
+
+	t1.AppendU32([]byte("u32"), 0x01020304)
+	t2.AppendMessage([]byte("u32"), []byte{4, 3, 2, 1})
+
+	t1.AppendI64([]byte("i64"), -2)
+	t2.AppendMessage([]byte("i64"), []byte{0xfe, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+
+	t1.AppendBool([]byte("true"), true)
+	t1.AppendBool([]byte("false"), false)
+	t2.AppendMessage([]byte("true"), []byte{1})
+	t2.AppendMessage([]byte("false"), []byte{0})
+
+	t1.AppendString([]byte("string"), "мерлин")
+	t2.AppendMessage([]byte("string"), []byte("мерлин"))
+
+	assertTranscripts(t, t1, t2)
+}
+
+func TestAppendBigInt(t *testing.T) {
+	for _, c := range []struct {
+		x        *big.Int
+		expected []byte
+	}{
+		{big.NewInt(0), []byte{0}},
+		{big.NewInt(1), []byte{0, 1}},
+		{big.NewInt(-1), []byte{1, 1}},
+		{big.NewInt(0x0102), []byte{0, 2, 1}},
+		{big.NewInt(-0x010000), []byte{1, 0, 0, 1}},
+		{new(big.Int).Lsh(big.NewInt(1), 64), []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 1}},
+	} {
+		assert.Equal(t, c.expected, encodeBigInt(c.x))
+
+		t1, t2 := NewTranscript("test protocol"), NewTranscript("test protocol")
+		t1.AppendBigInt([]byte("int"), c.x)
+		t2.AppendMessage([]byte("int"), c.expected)
+		assertTranscripts(t, t1, t2)
+	}
+}
+
+type failingMarshaler struct{}
+
+var errMarshal = errors.New("marshal failed")
+
+func (failingMarshaler) MarshalBinary() ([]byte, error) {
+	return nil, errMarshal
+}
+
+func TestAppendBinaryMarshaler(t *testing.T) {
+	t1, t2 := NewTranscript("test protocol"), NewTranscript("test protocol")
+	now := time.Unix(239, 239).UTC()
+	data, _ := now.MarshalBinary()
+
+	assert.NoError(t, t1.AppendBinaryMarshaler([]byte("time"), now))
+	t2.AppendMessage([]byte("time"), data)
+
+	// the transcript is left untouched on errors
+	assert.ErrorIs(t, t1.AppendBinaryMarshaler([]byte("time"), failingMarshaler{}), errMarshal)
+	assertTranscripts(t, t1, t2)
+}
@@ -0,0 +1,50 @@
+// Copyright © 2019. Sergey Skaredov.
+// Licensed under the MIT License.
+// See LICENSE.txt for details.
+
+package merlin
+
+import (
+	"encoding/binary"
+	"math/big"
+)
+
+// Number of extra challenge bits reduced by ChallengeBigInt,
+// statistical distance from uniform is at most 2^-challengeMargin
+const challengeMargin = 128
+
+// Extract a challenge integer uniform in [0, modulus) up to 2^-128
+// statistical distance: bitlen(modulus) + 128 challenge bits are read as
+// a little-endian integer and reduced modulo modulus.
+// Panics if modulus isn't positive
+// dest <- PRF[label || LE32(dest.len())](); c = LE(dest) mod modulus
+func (t *Transcript) ChallengeBigInt(label []byte, modulus *big.Int) *big.Int {
+	if modulus.Sign() <= 0 {
+		panic("Modulus must be positive")
+	}
+	buf := make([]byte, (modulus.BitLen()+challengeMargin+7)/8)
+	t.ChallengeBytes(label, buf)
+
+	c := decodeLE(buf)
+	return c.Mod(c, modulus)
+}
+
+// Extract a challenge uniform in [0, n) by rejection sampling:
+// 8-byte challenges with the same label are extracted until the LE64 value
+// falls into the largest multiple of n below 2^64, so both parties
+// make the same number of PRF calls. Panics if n is zero
+// dest <- PRF[label || LE32(8)](); ... c = LE64(dest) mod n
+func (t *Transcript) ChallengeUint64n(label []byte, n uint64) uint64 {
+	if n == 0 {
+		panic("Bound must be positive")
+	}
+	// values below 2^64 mod n are rejected, that's less than half of them
+	reject := -n % n
+	var buf [8]byte
+	for {
+		t.ChallengeBytes(label, buf[:])
+		if v := binary.LittleEndian.Uint64(buf[:]); v >= reject {
+			return v % n
+		}
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright © 2019. Sergey Skaredov.
+// Licensed under the MIT License.
+// See LICENSE.txt for details.
+
+package merlin
+
+import (
+	"encoding/binary"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"testing"
+)
+
+func TestChallengeBigInt(t *testing.T) {
+	// order of the ed25519 prime-order subgroup
+	l, _ := new(big.Int).SetString("7237005577332262213973186563042994240857116359379907606001950938285454250989", 10)
+
+	for _, modulus := range []*big.Int{big.NewInt(1), big.NewInt(239), l, new(big.Int).Lsh(big.NewInt(1), 521)} {
+		t1, t2 := NewTranscript("test protocol"), NewTranscript("test protocol")
+
+		c := t1.ChallengeBigInt([]byte("challenge"), modulus)
+		assert.True(t, c.Sign() >= 0 && c.Cmp(modulus) < 0)
+
+		// wide little-endian reduction of the same challenge bytes
+		buf := make([]byte, (modulus.BitLen()+128+7)/8)
+		t2.ChallengeBytes([]byte("challenge"), buf)
+		expected := new(big.Int)
+		for i := len(buf) - 1; i >= 0; i-- {
+			expected.Lsh(expected, 8)
+			expected.Or(expected, big.NewInt(int64(buf[i])))
+		}
+		expected.Mod(expected, modulus)
+		assert.Equal(t, 0, expected.Cmp(c))
+	}
+
+	tr := NewTranscript("test protocol")
+	assert.Panics(t, func() { tr.ChallengeBigInt([]byte("challenge"), big.NewInt(0)) })
+	assert.Panics(t, func() { tr.ChallengeBigInt([]byte("challenge"), big.NewInt(-239)) })
+}
+
+func TestChallengeUint64n(t *testing.T) {
+	t1, t2 := NewTranscript("test protocol"), NewTranscript("test protocol")
+	for _, n := range []uint64{1, 2, 3, 239, 1<<63 + 1, ^uint64(0)} {
+		c1 := t1.ChallengeUint64n([]byte("challenge"), n)
+		c2 := t2.ChallengeUint64n([]byte("challenge"), n)
+		assert.Equal(t, c1, c2)
+		assert.True(t, c1 < n)
+	}
+
+	// no rejections for powers of 2, the challenge is just the low bits
+	t1, t2 = NewTranscript("test protocol"), NewTranscript("test protocol")
+	var buf [8]byte
+	t2.ChallengeBytes([]byte("challenge"), buf[:])
+	assert.Equal(t, binary.LittleEndian.Uint64(buf[:])%1024, t1.ChallengeUint64n([]byte("challenge"), 1024))
+
+	// half of the values are rejected for n = 2^63 + 1, transcripts stay in sync
+	t1, t2 = NewTranscript("test protocol"), NewTranscript("test protocol")
+	for i := 0; i < 16; i++ {
+		assert.Equal(t, t1.ChallengeUint64n([]byte("challenge"), 1<<63+1), t2.ChallengeUint64n([]byte("challenge"), 1<<63+1))
+	}
+	c1, c2 := make([]byte, 32), make([]byte, 32)
+	t1.ChallengeBytes([]byte("sync"), c1)
+	t2.ChallengeBytes([]byte("sync"), c2)
+	assert.Equal(t, c1, c2)
+
+	// rough uniformity check
+	tr := NewTranscript("test protocol")
+	var counts [3]int
+	for i := 0; i < 3000; i++ {
+		counts[tr.ChallengeUint64n([]byte("challenge"), 3)]++
+	}
+	for _, count := range counts {
+		assert.InDelta(t, 1000, count, 150)
+	}
+
+	assert.Panics(t, func() { tr.ChallengeUint64n([]byte("challenge"), 0) })
+}
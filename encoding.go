@@ -0,0 +1,71 @@
+// Copyright © 2019. Sergey Skaredov.
+// Licensed under the MIT License.
+// See LICENSE.txt for details.
+
+package merlin
+
+import (
+	"errors"
+	"fmt"
+	. "github.com/skoret/merlin/strobe"
+)
+
+// Serialized Transcript and TranscriptRng layout, version 1:
+//
+//	version || kind || serialized Strobe
+//
+// The Strobe part is versioned and checksummed on its own.
+// Serialized TranscriptRng holds the secret state, keep it as secret as witnesses.
+const (
+	encodingVersion = 1
+	kindTranscript  = 't'
+	kindRng         = 'r'
+)
+
+var ErrInvalidTranscriptEncoding = errors.New("merlin: invalid transcript encoding")
+
+// Implement encoding.BinaryMarshaler,
+// e.g. to pause the prover while waiting for a challenge
+func (t *Transcript) MarshalBinary() ([]byte, error) {
+	return marshal(kindTranscript, &t.strobe)
+}
+
+// Implement encoding.BinaryUnmarshaler, restored transcript
+// produces the same challenges as the serialized one
+func (t *Transcript) UnmarshalBinary(data []byte) error {
+	return unmarshal(kindTranscript, &t.strobe, data)
+}
+
+// Implement encoding.BinaryMarshaler
+func (t *TranscriptRng) MarshalBinary() ([]byte, error) {
+	return marshal(kindRng, &t.strobe)
+}
+
+// Implement encoding.BinaryUnmarshaler
+func (t *TranscriptRng) UnmarshalBinary(data []byte) error {
+	return unmarshal(kindRng, &t.strobe, data)
+}
+
+func marshal(kind byte, s *Strobe) ([]byte, error) {
+	state, err := s.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{encodingVersion, kind}, state...), nil
+}
+
+func unmarshal(kind byte, s *Strobe, data []byte) error {
+	if len(data) < 2 {
+		return fmt.Errorf("%w: too short", ErrInvalidTranscriptEncoding)
+	}
+	if data[0] != encodingVersion {
+		return fmt.Errorf("%w: unsupported version %d", ErrInvalidTranscriptEncoding, data[0])
+	}
+	if data[1] != kind {
+		return fmt.Errorf("%w: unexpected kind %q instead of %q", ErrInvalidTranscriptEncoding, data[1], kind)
+	}
+	if err := s.UnmarshalBinary(data[2:]); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidTranscriptEncoding, err)
+	}
+	return nil
+}
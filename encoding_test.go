@@ -0,0 +1,75 @@
+// Copyright © 2019. Sergey Skaredov.
+// Licensed under the MIT License.
+// See LICENSE.txt for details.
+
+package merlin
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"testing"
+)
+
+func TestTranscriptMarshalBinary(t *testing.T) {
+	prover := NewTranscript("test protocol")
+	verifier := NewTranscript("test protocol")
+	for _, tr := range []*Transcript{prover, verifier} {
+		tr.AppendMessage([]byte("commitment"), []byte("first round commitment"))
+	}
+
+	// prover pauses until the verifier sends a challenge
+	paused, err := prover.MarshalBinary()
+	assert.NoError(t, err)
+
+	c1, c2 := make([]byte, 32), make([]byte, 32)
+	verifier.ChallengeBytes([]byte("challenge"), c1)
+
+	var resumed Transcript
+	assert.NoError(t, resumed.UnmarshalBinary(paused))
+	resumed.ChallengeBytes([]byte("challenge"), c2)
+	assert.Equal(t, c1, c2)
+
+	for _, tr := range []*Transcript{&resumed, verifier} {
+		tr.AppendMessage([]byte("response"), []byte("second round response"))
+	}
+	verifier.ChallengeBytes([]byte("challenge"), c1)
+	resumed.ChallengeBytes([]byte("challenge"), c2)
+	assert.Equal(t, c1, c2)
+}
+
+func TestTranscriptRngMarshalBinary(t *testing.T) {
+	r1 := build("label", "commitment", "witness", rand.New(rand.NewSource(239)))
+	generate(t, r1)
+
+	encoded, err := r1.MarshalBinary()
+	assert.NoError(t, err)
+
+	var r2 TranscriptRng
+	assert.NoError(t, r2.UnmarshalBinary(encoded))
+	assert.Equal(t, generate(t, r1), generate(t, &r2))
+}
+
+func TestUnmarshalBinaryInvalid(t *testing.T) {
+	tr := NewTranscript("test protocol")
+	transcript, _ := tr.MarshalBinary()
+	rng, _ := build("label", "commitment", "witness", rand.New(rand.NewSource(239))).MarshalBinary()
+
+	corrupted := append([]byte{}, transcript...)
+	corrupted[len(corrupted)/2] ^= 1
+	version := append([]byte{}, transcript...)
+	version[0] = encodingVersion + 1
+
+	var restored Transcript
+	for name, data := range map[string][]byte{
+		"empty":     nil,
+		"truncated": transcript[:len(transcript)-1],
+		"corrupted": corrupted,
+		"version":   version,
+		"kind":      rng,
+	} {
+		assert.ErrorIs(t, restored.UnmarshalBinary(data), ErrInvalidTranscriptEncoding, name)
+	}
+
+	var restoredRng TranscriptRng
+	assert.ErrorIs(t, restoredRng.UnmarshalBinary(transcript), ErrInvalidTranscriptEncoding)
+}
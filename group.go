@@ -0,0 +1,231 @@
+// Copyright © 2019. Sergey Skaredov.
+// Licensed under the MIT License.
+// See LICENSE.txt for details.
+
+package merlin
+
+import (
+	"errors"
+	"math/big"
+)
+
+var (
+	ErrIdentityElement = errors.New("merlin: identity element")
+	ErrInvalidElement  = errors.New("merlin: invalid group element encoding")
+	ErrInvalidScalar   = errors.New("merlin: invalid scalar encoding")
+)
+
+// Scalar of a prime-order group, Bytes returns its canonical encoding
+type Scalar interface {
+	Bytes() []byte
+}
+
+// Element of a prime-order group, Bytes returns its canonical encoding
+type Element interface {
+	Bytes() []byte
+	IsIdentity() bool
+}
+
+// Group adapts a prime-order group, e.g. Ristretto255, P-256 or BLS12-381,
+// to transcripts: ChallengeScalar extracts ChallengeLength() bytes, which
+// must be at least bitlen(order) + 128 bits, and maps them to a scalar
+// with ScalarFromChallenge by wide reduction modulo the group order
+type Group interface {
+	ChallengeLength() int
+	ScalarFromChallenge(challenge []byte) Scalar
+}
+
+// Add the canonical encoding of the scalar s to the transcript
+// AD[label || LE32(len(s))](s);
+func (t *Transcript) AppendScalar(label []byte, s Scalar) {
+	t.AppendMessage(label, s.Bytes())
+}
+
+// Add the canonical encoding of the group element e to the transcript
+// AD[label || LE32(len(e))](e);
+func (t *Transcript) AppendPoint(label []byte, e Element) {
+	t.AppendMessage(label, e.Bytes())
+}
+
+// The same as AppendPoint, but returns ErrIdentityElement
+// and leaves the transcript untouched if e is the identity
+func (t *Transcript) ValidateAndAppendPoint(label []byte, e Element) error {
+	if e.IsIdentity() {
+		return ErrIdentityElement
+	}
+	t.AppendPoint(label, e)
+	return nil
+}
+
+// Extract a challenge scalar of the group g
+// dest <- PRF[label || LE32(g.ChallengeLength())](); c = g.ScalarFromChallenge(dest)
+func (t *Transcript) ChallengeScalar(label []byte, g Group) Scalar {
+	buf := make([]byte, g.ChallengeLength())
+	t.ChallengeBytes(label, buf)
+	return g.ScalarFromChallenge(buf)
+}
+
+// SchnorrGroup is a reference Group: the subgroup of prime order q
+// of the multiplicative group modulo a prime p, generated by g.
+// Scalars are integers modulo q and elements are integers modulo p,
+// both encoded little-endian with the fixed length of q and p respectively.
+// It is meant for tests and examples, it isn't constant-time
+type SchnorrGroup struct {
+	p, q, g *big.Int
+}
+
+type schnorrScalar struct {
+	v    *big.Int
+	size int
+}
+
+type schnorrElement struct {
+	v    *big.Int
+	size int
+}
+
+func (s schnorrScalar) Bytes() []byte {
+	return encodeLE(s.v, s.size)
+}
+
+func (e schnorrElement) Bytes() []byte {
+	return encodeLE(e.v, e.size)
+}
+
+func (e schnorrElement) IsIdentity() bool {
+	return e.v.Cmp(big.NewInt(1)) == 0
+}
+
+// Initialize the subgroup of order q modulo p generated by g,
+// panics if p or q isn't prime, q doesn't divide p-1 or g isn't of order q
+func NewSchnorrGroup(p, q, g *big.Int) *SchnorrGroup {
+	one := big.NewInt(1)
+	if !p.ProbablyPrime(32) || !q.ProbablyPrime(32) {
+		panic("Group modulus and order must be prime")
+	}
+	if new(big.Int).Mod(new(big.Int).Sub(p, one), q).Sign() != 0 {
+		panic("Group order must divide modulus - 1")
+	}
+	if g.Cmp(one) <= 0 || g.Cmp(p) >= 0 || new(big.Int).Exp(g, q, p).Cmp(one) != 0 {
+		panic("Generator must be of the group order")
+	}
+	return &SchnorrGroup{
+		p: new(big.Int).Set(p),
+		q: new(big.Int).Set(q),
+		g: new(big.Int).Set(g),
+	}
+}
+
+func (g *SchnorrGroup) Order() *big.Int {
+	return new(big.Int).Set(g.q)
+}
+
+func (g *SchnorrGroup) Generator() Element {
+	return g.element(new(big.Int).Set(g.g))
+}
+
+func (g *SchnorrGroup) Identity() Element {
+	return g.element(big.NewInt(1))
+}
+
+// Scalar x mod q
+func (g *SchnorrGroup) Scalar(x *big.Int) Scalar {
+	return g.scalar(new(big.Int).Mod(x, g.q))
+}
+
+// Decode a canonical scalar, returns ErrInvalidScalar
+// if data has a wrong length or isn't reduced modulo q
+func (g *SchnorrGroup) ScalarFromBytes(data []byte) (Scalar, error) {
+	v := decodeLE(data)
+	if len(data) != byteLen(g.q) || v.Cmp(g.q) >= 0 {
+		return nil, ErrInvalidScalar
+	}
+	return g.scalar(v), nil
+}
+
+// Decode a canonical element, returns ErrInvalidElement
+// if data has a wrong length or isn't an element of the subgroup
+func (g *SchnorrGroup) ElementFromBytes(data []byte) (Element, error) {
+	v := decodeLE(data)
+	if len(data) != byteLen(g.p) || v.Sign() <= 0 || v.Cmp(g.p) >= 0 ||
+		new(big.Int).Exp(v, g.q, g.p).Cmp(big.NewInt(1)) != 0 {
+		return nil, ErrInvalidElement
+	}
+	return g.element(v), nil
+}
+
+// e^s, panics if e or s is from another group
+func (g *SchnorrGroup) Exp(e Element, s Scalar) Element {
+	return g.element(new(big.Int).Exp(g.unwrapElement(e), g.unwrapScalar(s), g.p))
+}
+
+// e1 * e2, panics if e1 or e2 is from another group
+func (g *SchnorrGroup) Mul(e1, e2 Element) Element {
+	v := new(big.Int).Mul(g.unwrapElement(e1), g.unwrapElement(e2))
+	return g.element(v.Mod(v, g.p))
+}
+
+// s1 + s2 * s3 mod q, panics if any scalar is from another group
+func (g *SchnorrGroup) MulAdd(s1, s2, s3 Scalar) Scalar {
+	v := new(big.Int).Mul(g.unwrapScalar(s2), g.unwrapScalar(s3))
+	v.Add(v, g.unwrapScalar(s1))
+	return g.scalar(v.Mod(v, g.q))
+}
+
+// Implement Group: bitlen(q) + 128 bits
+func (g *SchnorrGroup) ChallengeLength() int {
+	return (g.q.BitLen() + challengeMargin + 7) / 8
+}
+
+// Implement Group: LE(challenge) mod q
+func (g *SchnorrGroup) ScalarFromChallenge(challenge []byte) Scalar {
+	return g.Scalar(decodeLE(challenge))
+}
+
+func (g *SchnorrGroup) scalar(v *big.Int) Scalar {
+	return schnorrScalar{v, byteLen(g.q)}
+}
+
+func (g *SchnorrGroup) element(v *big.Int) Element {
+	return schnorrElement{v, byteLen(g.p)}
+}
+
+func (g *SchnorrGroup) unwrapScalar(s Scalar) *big.Int {
+	v, ok := s.(schnorrScalar)
+	if !ok || v.size != byteLen(g.q) || v.v.Cmp(g.q) >= 0 {
+		panic("Scalar isn't from this group")
+	}
+	return v.v
+}
+
+func (g *SchnorrGroup) unwrapElement(e Element) *big.Int {
+	v, ok := e.(schnorrElement)
+	if !ok || v.size != byteLen(g.p) || v.v.Cmp(g.p) >= 0 {
+		panic("Element isn't from this group")
+	}
+	return v.v
+}
+
+func byteLen(x *big.Int) int {
+	return (x.BitLen() + 7) / 8
+}
+
+// Little-endian encoding of non-negative x in size bytes
+func encodeLE(x *big.Int, size int) []byte {
+	data := x.FillBytes(make([]byte, size))
+	reverse(data)
+	return data
+}
+
+func decodeLE(data []byte) *big.Int {
+	be := make([]byte, len(data))
+	copy(be, data)
+	reverse(be)
+	return new(big.Int).SetBytes(be)
+}
+
+func reverse(data []byte) {
+	for i, j := 0, len(data)-1; i < j; i, j = i+1, j-1 {
+		data[i], data[j] = data[j], data[i]
+	}
+}
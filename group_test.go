@@ -0,0 +1,135 @@
+// Copyright © 2019. Sergey Skaredov.
+// Licensed under the MIT License.
+// See LICENSE.txt for details.
+
+package merlin
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"testing"
+)
+
+// Subgroup of quadratic residues modulo the safe prime p = 2q + 1
+func testGroup() *SchnorrGroup {
+	p, _ := new(big.Int).SetString("800000000000000000000000000000000000000000000000000000000002ff7f", 16)
+	q, _ := new(big.Int).SetString("4000000000000000000000000000000000000000000000000000000000017fbf", 16)
+	return NewSchnorrGroup(p, q, big.NewInt(4))
+}
+
+// Non-interactive Schnorr proof of knowledge of x such that X = g^x
+func prove(g *SchnorrGroup, x Scalar, X Element) (Element, Scalar) {
+	t := NewTranscript("schnorr")
+	t.AppendPoint([]byte("X"), X)
+
+	b := t.BuildRng()
+	b.RekeyWithWitness([]byte("x"), x.Bytes())
+	kBytes := make([]byte, g.ChallengeLength())
+	b.Finalize(nil).Read(kBytes)
+	k := g.ScalarFromChallenge(kBytes)
+
+	R := g.Exp(g.Generator(), k)
+	t.AppendPoint([]byte("R"), R)
+	c := t.ChallengeScalar([]byte("c"), g)
+	return R, g.MulAdd(k, c, x)
+}
+
+var errInvalidProof = errors.New("invalid proof")
+
+func verify(g *SchnorrGroup, X, R Element, s Scalar) error {
+	t := NewTranscript("schnorr")
+	if err := t.ValidateAndAppendPoint([]byte("X"), X); err != nil {
+		return err
+	}
+	if err := t.ValidateAndAppendPoint([]byte("R"), R); err != nil {
+		return err
+	}
+	c := t.ChallengeScalar([]byte("c"), g)
+	if string(g.Exp(g.Generator(), s).Bytes()) != string(g.Mul(R, g.Exp(X, c)).Bytes()) {
+		return errInvalidProof
+	}
+	return nil
+}
+
+func TestSchnorrProof(t *testing.T) {
+	g := testGroup()
+	x := g.Scalar(big.NewInt(239))
+	X := g.Exp(g.Generator(), x)
+
+	R, s := prove(g, x, X)
+	assert.NoError(t, verify(g, X, R, s))
+
+	// wrong statement
+	Y := g.Exp(g.Generator(), g.Scalar(big.NewInt(240)))
+	assert.ErrorIs(t, verify(g, Y, R, s), errInvalidProof)
+
+	// identity elements are rejected
+	assert.ErrorIs(t, verify(g, g.Identity(), R, s), ErrIdentityElement)
+}
+
+func TestAppendPoint(t *testing.T) {
+	g := testGroup()
+	e := g.Generator()
+	s := g.Scalar(big.NewInt(-1))
+
+	t1, t2 := NewTranscript("test protocol"), NewTranscript("test protocol")
+	t1.AppendScalar([]byte("scalar"), s)
+	t1.AppendPoint([]byte("point"), e)
+	assert.NoError(t, t1.ValidateAndAppendPoint([]byte("point"), e))
+	t2.AppendMessage([]byte("scalar"), s.Bytes())
+	t2.AppendMessage([]byte("point"), e.Bytes())
+	t2.AppendMessage([]byte("point"), e.Bytes())
+
+	// identity is rejected and the transcript is left untouched
+	assert.ErrorIs(t, t1.ValidateAndAppendPoint([]byte("point"), g.Identity()), ErrIdentityElement)
+
+	c1, c2 := make([]byte, 32), make([]byte, 32)
+	t1.ChallengeBytes([]byte("challenge"), c1)
+	t2.ChallengeBytes([]byte("challenge"), c2)
+	assert.Equal(t, c1, c2)
+}
+
+func TestChallengeScalar(t *testing.T) {
+	g := testGroup()
+	t1, t2 := NewTranscript("test protocol"), NewTranscript("test protocol")
+
+	c := t1.ChallengeScalar([]byte("challenge"), g)
+	assert.Equal(t, (255+128+7)/8, g.ChallengeLength())
+	expected := t2.ChallengeBigInt([]byte("challenge"), g.Order())
+	assert.Equal(t, g.Scalar(expected).Bytes(), c.Bytes())
+}
+
+func TestSchnorrGroupEncoding(t *testing.T) {
+	g := testGroup()
+
+	s := g.Scalar(big.NewInt(-1))
+	assert.Len(t, s.Bytes(), 32)
+	decoded, err := g.ScalarFromBytes(s.Bytes())
+	assert.NoError(t, err)
+	assert.Equal(t, s, decoded)
+	_, err = g.ScalarFromBytes(g.Order().FillBytes(make([]byte, 32)))
+	assert.ErrorIs(t, err, ErrInvalidScalar)
+	_, err = g.ScalarFromBytes(s.Bytes()[:31])
+	assert.ErrorIs(t, err, ErrInvalidScalar)
+
+	e := g.Exp(g.Generator(), s)
+	assert.Len(t, e.Bytes(), 32)
+	assert.Equal(t, []byte{4}, g.Generator().Bytes()[:1])
+	decodedE, err := g.ElementFromBytes(e.Bytes())
+	assert.NoError(t, err)
+	assert.Equal(t, e, decodedE)
+	assert.True(t, g.Mul(e, g.Generator()).IsIdentity())
+
+	// -1 is a quadratic non-residue modulo p = 3 mod 4, so it's out of the subgroup
+	minusOne := new(big.Int).Sub(g.p, big.NewInt(1))
+	_, err = g.ElementFromBytes(encodeLE(minusOne, 32))
+	assert.ErrorIs(t, err, ErrInvalidElement)
+	_, err = g.ElementFromBytes(make([]byte, 32))
+	assert.ErrorIs(t, err, ErrInvalidElement)
+
+	assert.Panics(t, func() { NewSchnorrGroup(big.NewInt(23), big.NewInt(11), big.NewInt(5)) })
+	assert.Panics(t, func() { NewSchnorrGroup(big.NewInt(23), big.NewInt(7), big.NewInt(4)) })
+	other := NewSchnorrGroup(big.NewInt(23), big.NewInt(11), big.NewInt(4))
+	assert.Panics(t, func() { g.Exp(other.Generator(), s) })
+}
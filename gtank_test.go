@@ -0,0 +1,114 @@
+// Copyright © 2019. Sergey Skaredov.
+// Licensed under the MIT License.
+// See LICENSE.txt for details.
+
+//go:build gtank
+// +build gtank
+
+// Equivalence with gtank/merlin, run with go test -tags gtank.
+// The suite runs offline without it, the same transcripts are checked
+// against testdata/transcript_vectors.json by TestVectors
+
+package merlin
+
+import (
+	"encoding/hex"
+	"github.com/gtank/merlin"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func prt(t *testing.T, message string, t1 Transcript, t2 merlin.Transcript) {
+	t.Logf("%s:\n\t%+v\n\t%+v", message, t1, t2)
+	t.Log("---------------------------------------------------------------------------")
+}
+
+func TestEquivalenceSimple(t *testing.T) {
+	t1 := NewTranscript("test protocol")
+	t2 := merlin.NewTranscript("test protocol")
+	prt(t, "init", *t1, *t2)
+
+	t1.AppendMessage([]byte("test label"), []byte("test data"))
+	t2.AppendMessage([]byte("test label"), []byte("test data"))
+	prt(t, "add", *t1, *t2)
+
+	c1 := make([]byte, 32)
+	t1.ChallengeBytes([]byte("challenge"), c1)
+	c2 := t2.ExtractBytes([]byte("challenge"), 32)
+	prt(t, "challenge", *t1, *t2)
+
+	t.Logf("challenge bytes:\n\t%s\n\t%s", hex.EncodeToString(c1), hex.EncodeToString(c2))
+	assert.Equal(t, c1, c2)
+}
+
+func TestEquivalenceComplex(t *testing.T) {
+	t1 := NewTranscript("test protocol")
+	t2 := merlin.NewTranscript("test protocol")
+	prt(t, "init", *t1, *t2)
+
+	t1.AppendMessage([]byte("test label"), []byte("test data"))
+	t2.AppendMessage([]byte("test label"), []byte("test data"))
+	prt(t, "add", *t1, *t2)
+
+	lorem := make([]byte, 1024)
+	for i := range lorem {
+		lorem[i] = 239
+	}
+
+	var c1, c2 []byte = make([]byte, 32), nil
+
+	for i := 0; i < 32; i++ {
+		t1.ChallengeBytes([]byte("challenge"), c1)
+		c2 = t2.ExtractBytes([]byte("challenge"), 32)
+
+		assert.Equal(t, c1, c2)
+
+		t1.AppendMessage([]byte("lorem ipsum"), lorem)
+		t2.AppendMessage([]byte("lorem ipsum"), lorem)
+
+		t1.AppendMessage([]byte("challenge data"), lorem)
+		t2.AppendMessage([]byte("challenge data"), lorem)
+	}
+
+	prt(t, "final state", *t1, *t2)
+	t.Logf("challenge bytes:\n\t%s\n\t%s", hex.EncodeToString(c1), hex.EncodeToString(c2))
+	assert.Equal(t, c1, c2)
+}
+
+// Counterparts of the Mini benchmarks in merlin_test.go
+func BenchmarkGtankNewTranscript(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		merlin.NewTranscript("test protocol")
+	}
+}
+
+func BenchmarkGtankAppendMessage(b *testing.B) {
+	for _, size := range []struct {
+		name string
+		size int
+	}{
+		{"32B", 32},
+		{"1KiB", 1 << 10},
+		{"1MiB", 1 << 20},
+	} {
+		message := make([]byte, size.size)
+
+		b.Run(size.name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(message)))
+			t := merlin.NewTranscript("test protocol")
+			for i := 0; i < b.N; i++ {
+				t.AppendMessage([]byte("message"), message)
+			}
+		})
+	}
+}
+
+func BenchmarkGtankChallengeBytes(b *testing.B) {
+	b.ReportAllocs()
+	t := merlin.NewTranscript("test protocol")
+	for i := 0; i < b.N; i++ {
+		t.ExtractBytes([]byte("challenge"), 32)
+	}
+}
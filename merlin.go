@@ -13,7 +13,10 @@
 package merlin
 
 import (
+	"crypto/rand"
 	"encoding/binary"
+	"errors"
+	"fmt"
 	. "github.com/skoret/merlin/strobe"
 	"io"
 )
@@ -21,7 +24,14 @@ import (
 const (
 	ProtocolLabel   = "Merlin v1.0"
 	DomainSeparator = "dom-sep"
-	MaxBufferLength = 1 << 32
+	MaxBufferLength = 1<<32 - 1 // length of any buffer is encoded as LE32
+
+	ratchetLength = 32 // number of state bytes zeroed out by Ratchet
+)
+
+var (
+	ErrBufferTooLarge   = errors.New("merlin: buffer length is more than max allowed (2^32 - 1)")
+	ErrBuilderFinalized = errors.New("merlin: TranscriptRngBuilder is already finalized")
 )
 
 func encodeU32(u32 uint32) []byte {
@@ -37,28 +47,89 @@ func encodeU64(u64 uint64) []byte {
 }
 
 type Transcript struct {
-	strobe Strobe
+	strobe   Strobe
+	recorder Recorder
 }
 
 // Initialize new Merlin transcript object
 // with a label — an application-specific domain separator
 func NewTranscript(label string) *Transcript {
+	return NewTranscriptWithRecorder(label, nil)
+}
+
+// The same as NewTranscript, but every operation on the transcript and on
+// its TranscriptRngBuilder is passed to recorder, nil recorder records nothing.
+// Use it to debug diverging transcripts, see Diff
+func NewTranscriptWithRecorder(label string, recorder Recorder) *Transcript {
 	t := Transcript{
-		strobe: NewStrobe(ProtocolLabel),
+		strobe:   NewStrobe(ProtocolLabel),
+		recorder: recorder,
 	}
 
 	bytes := encodeU32(uint32(len([]byte(label))))
 	t.strobe.MetaAd([]byte(DomainSeparator), false)
 	t.strobe.MetaAd(bytes, true)
 	t.strobe.Ad([]byte(label), false)
+	record(recorder, "init", []byte(label), []byte(label))
 	return &t
 }
 
+// Make an independent deep copy of the transcript,
+// e.g. to fork it for branches of an OR-proof.
+// The copy shares the recorder of t, see CloneWithRecorder
+func (t *Transcript) Clone() *Transcript {
+	return t.CloneWithRecorder(t.recorder)
+}
+
+// The same as Clone, but operations on the copy are passed to recorder,
+// e.g. to record every branch of an OR-proof separately.
+// The fork is recorded as "clone" by both recorders
+func (t *Transcript) CloneWithRecorder(recorder Recorder) *Transcript {
+	recordLength(t.recorder, "clone", nil, 0)
+	if recorder != t.recorder {
+		recordLength(recorder, "clone", nil, 0)
+	}
+	return &Transcript{
+		strobe:   t.strobe.Clone(),
+		recorder: recorder,
+	}
+}
+
 // Add the message from src parameter to the transcript with the supplied label
 // AD[label || LE32(len(message))](message);
 func (t *Transcript) AppendMessage(label []byte, src []byte) {
-	storeMeta(&t.strobe, label, src)
+	storeMeta(&t.strobe, label, len(src))
 	t.strobe.Ad(src, false)
+	record(t.recorder, "append", label, src)
+}
+
+// The same as AppendMessage, but returns ErrBufferTooLarge
+// instead of panicking if src is too large
+// and strobe.ErrDestroyed if the transcript is destroyed
+func (t *Transcript) TryAppendMessage(label []byte, src []byte) error {
+	if err := checkOp(&t.strobe, len(src)); err != nil {
+		return err
+	}
+	t.AppendMessage(label, src)
+	return nil
+}
+
+// Add the message of the given length read from src to the transcript
+// without buffering it, the transcript is the same as after AppendMessage.
+// If src has less than length bytes, the transcript is left in the middle
+// of the operation and mustn't be used after the returned error
+// AD[label || LE32(length)](message);
+func (t *Transcript) AppendMessageStream(label []byte, length int, src io.Reader) error {
+	if err := checkOp(&t.strobe, length); err != nil {
+		return err
+	}
+	storeMeta(&t.strobe, label, length)
+	rr := newRecordingReader(t.recorder, src)
+	if err := stream(t.strobe.Ad, length, rr); err != nil {
+		return err
+	}
+	rr.record(t.recorder, "append", label, length)
+	return nil
 }
 
 func (t *Transcript) AppendU64(label []byte, u64 uint64) {
@@ -68,14 +139,74 @@ func (t *Transcript) AppendU64(label []byte, u64 uint64) {
 // Extract sequence of verifiers's challenge bytes to data parameter
 // dest <- PRF[label || LE32(dest.len())]();
 func (t *Transcript) ChallengeBytes(label []byte, dest []byte) {
-	storeMeta(&t.strobe, label, dest)
+	storeMeta(&t.strobe, label, len(dest))
 	t.strobe.Prf(dest, false)
+	record(t.recorder, "challenge", label, dest)
+}
+
+// The same as ChallengeBytes, but returns ErrBufferTooLarge
+// instead of panicking if dest is too large
+// and strobe.ErrDestroyed if the transcript is destroyed
+func (t *Transcript) TryChallengeBytes(label []byte, dest []byte) error {
+	if err := checkOp(&t.strobe, len(dest)); err != nil {
+		return err
+	}
+	t.ChallengeBytes(label, dest)
+	return nil
+}
+
+// Erase a part of the transcript state, so that previously extracted
+// challenges can't be recovered from the current state
+// RATCHET[label || LE32(32)]();
+func (t *Transcript) Ratchet(label []byte) {
+	storeMeta(&t.strobe, label, ratchetLength)
+	t.strobe.Ratchet(ratchetLength, false)
+	recordLength(t.recorder, "ratchet", label, ratchetLength)
+}
+
+// Wipe the transcript state, any later use of the transcript
+// panics or returns strobe.ErrDestroyed. Clones and builders
+// made before are independent and have to be destroyed separately
+func (t *Transcript) Destroy() {
+	t.strobe.Destroy()
+}
+
+// Adapter to write chunks of data into continuation of a strobe operation
+type operation func(data []byte, more bool)
+
+func (op operation) Write(data []byte) (int, error) {
+	op(data, true)
+	return len(data), nil
+}
+
+// Run the operation over length bytes of src chunk by chunk
+func stream(op operation, length int, src io.Reader) error {
+	op(nil, false)
+	_, err := io.CopyN(op, src, int64(length))
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func checkLength(length int) error {
+	if length < 0 || uint64(length) > MaxBufferLength {
+		return fmt.Errorf("%w: %d", ErrBufferTooLarge, length)
+	}
+	return nil
 }
 
-func storeMeta(strobe *Strobe, label []byte, data []byte) {
-	length := len(data)
-	if length > MaxBufferLength {
-		panic("Buffer length " + string(length) + " is more then max allowed (2^32)")
+// Check that the operation over length bytes can be started on strobe
+func checkOp(strobe *Strobe, length int) error {
+	if strobe.Destroyed() {
+		return ErrDestroyed
+	}
+	return checkLength(length)
+}
+
+func storeMeta(strobe *Strobe, label []byte, length int) {
+	if err := checkLength(length); err != nil {
+		panic(err)
 	}
 	bytes := encodeU32(uint32(length))
 	strobe.MetaAd(label, false)
@@ -84,39 +215,123 @@ func storeMeta(strobe *Strobe, label []byte, data []byte) {
 
 // Use TranscriptRngBuilder to rekey the Transcript with witness data
 // and then to finalize it with an external rng to a TranscriptRng.
+// The builder is one-shot: once finalized, its state moves to the
+// TranscriptRng and any later use fails with ErrBuilderFinalized
 type TranscriptRngBuilder struct {
-	strobe Strobe
+	strobe    Strobe
+	finalized bool
+	recorder  Recorder
 }
 
-func (t *Transcript) BuildRng() TranscriptRngBuilder {
-	return TranscriptRngBuilder{
-		t.strobe.Clone(),
+// Start building a TranscriptRng from the transcript state.
+// The builder is returned by pointer, so that all references to it
+// share the one-shot lifecycle; don't copy the builder value itself
+func (t *Transcript) BuildRng() *TranscriptRngBuilder {
+	return &TranscriptRngBuilder{
+		strobe:   t.strobe.Clone(),
+		recorder: t.recorder,
 	}
 }
 
 // Rekey the transcript using the provided witness src
-// The label parameter is metadata about witness
+// The label parameter is metadata about witness.
+// Panics if the builder is already finalized, see TryRekeyWithWitness
 // KEY[label || LE32(witness.len())](witness);
 func (t *TranscriptRngBuilder) RekeyWithWitness(label []byte, src []byte) {
-	storeMeta(&t.strobe, label, src)
+	if t.finalized {
+		panic(ErrBuilderFinalized)
+	}
+	storeMeta(&t.strobe, label, len(src))
 	t.strobe.Key(src, false)
+	recordLength(t.recorder, "rekey", label, len(src))
+}
+
+// The same as RekeyWithWitness, but returns ErrBuilderFinalized,
+// ErrBufferTooLarge or strobe.ErrDestroyed instead of panicking
+func (t *TranscriptRngBuilder) TryRekeyWithWitness(label []byte, src []byte) error {
+	if err := t.check(len(src)); err != nil {
+		return err
+	}
+	t.RekeyWithWitness(label, src)
+	return nil
+}
+
+// Rekey the transcript using the witness of the given length read from src,
+// the same way as RekeyWithWitness does it with the whole witness
+// KEY[label || LE32(length)](witness);
+func (t *TranscriptRngBuilder) RekeyWithWitnessStream(label []byte, length int, src io.Reader) error {
+	if err := t.check(length); err != nil {
+		return err
+	}
+	storeMeta(&t.strobe, label, length)
+	if err := stream(t.strobe.Key, length, src); err != nil {
+		return err
+	}
+	recordLength(t.recorder, "rekey", label, length)
+	return nil
 }
 
 // Use the supplied external rng to rekey the transcript, so
 // that the finalized TranscriptRng is a PRF bound to
 // randomness from the external RNG, as well as all other
 // transcript data.
+// Panics if rng fails or the builder is already finalized, see FinalizeE
 // KEY[b"rng"](rng);
 func (t *TranscriptRngBuilder) Finalize(rng io.Reader) *TranscriptRng {
+	r, err := t.FinalizeE(rng)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// The same as Finalize, but returns an error if rng fails
+// to provide 32 bytes of entropy, the builder is left untouched then,
+// ErrBuilderFinalized if the builder is already finalized
+// or strobe.ErrDestroyed if the builder is destroyed.
+// If rng is nil, crypto/rand.Reader is used.
+func (t *TranscriptRngBuilder) FinalizeE(rng io.Reader) (*TranscriptRng, error) {
+	if err := t.check(0); err != nil {
+		return nil, err
+	}
+	if rng == nil {
+		rng = rand.Reader
+	}
 	entropy := make([]byte, 32)
-	_, _ = rng.Read(entropy)
+	// the entropy is as secret as the witnesses, wipe it on any return
+	defer func() {
+		for i := range entropy {
+			entropy[i] = 0
+		}
+	}()
+	if _, err := io.ReadFull(rng, entropy); err != nil {
+		return nil, fmt.Errorf("merlin: unable to read entropy from rng: %w", err)
+	}
 
 	t.strobe.MetaAd([]byte("rng"), false)
 	t.strobe.Key(entropy, false)
+	recordLength(t.recorder, "finalize", []byte("rng"), len(entropy))
 
-	return &TranscriptRng{
+	r := &TranscriptRng{
 		t.strobe.Clone(),
 	}
+	t.strobe.Destroy()
+	t.finalized = true
+	return r, nil
+}
+
+// Check that the builder can run an operation over length bytes
+func (t *TranscriptRngBuilder) check(length int) error {
+	if t.finalized {
+		return ErrBuilderFinalized
+	}
+	return checkOp(&t.strobe, length)
+}
+
+// Wipe the witness-keyed state of the builder, any later use
+// of the builder panics or returns strobe.ErrDestroyed
+func (t *TranscriptRngBuilder) Destroy() {
+	t.strobe.Destroy()
 }
 
 type TranscriptRng struct {
@@ -126,18 +341,47 @@ type TranscriptRng struct {
 // Generate len(dest) synthetic random bytes
 // based on full transcript history and randomness from rng
 // and write them into dest buffer.
-// Possible improvements if len(dest) > 2^32:
-//	* read 2^32 bytes and return (2^32, err)
-//	* read len(dest) bytes in q+1 iterations, where
-//		q = len(dest) / 2^32 with length 2^32
-//		and the last with length r = len(dest) % 2^32 != 0
+// If len(dest) > MaxBufferLength, the bytes are generated
+// in q+1 separate PRF calls, where
+//
+//	q = len(dest) / MaxBufferLength with length MaxBufferLength
+//	and the last with length r = len(dest) % MaxBufferLength != 0
+//
+// Returns strobe.ErrDestroyed if the rng is destroyed
+// dest <- PRF[LE32(dest.len())]();
 func (t *TranscriptRng) Read(dest []byte) (n int, err error) {
-	n, err = len(dest), nil
-	if n > MaxBufferLength {
-		panic("Buffer length " + string(n) + " is more then max allowed (2^32)")
+	if t.strobe.Destroyed() {
+		return 0, ErrDestroyed
 	}
-	bytes := encodeU32(uint32(n))
+	t.read(dest, MaxBufferLength)
+	return len(dest), nil
+}
+
+func (t *TranscriptRng) read(dest []byte, chunk uint64) {
+	for uint64(len(dest)) > chunk {
+		t.prf(dest[:chunk])
+		dest = dest[chunk:]
+	}
+	t.prf(dest)
+}
+
+func (t *TranscriptRng) prf(dest []byte) {
+	bytes := encodeU32(uint32(len(dest)))
 	t.strobe.MetaAd(bytes, false)
 	t.strobe.Prf(dest, false)
-	return
+}
+
+// Erase a part of the rng state to make it forward secure:
+// bytes generated before the ratchet can't be recovered
+// even if the TranscriptRng is compromised afterwards
+// RATCHET[LE32(32)]();
+func (t *TranscriptRng) Ratchet() {
+	t.strobe.MetaAd(encodeU32(ratchetLength), false)
+	t.strobe.Ratchet(ratchetLength, false)
+}
+
+// Wipe the rng state, any later use of the rng
+// panics or returns strobe.ErrDestroyed
+func (t *TranscriptRng) Destroy() {
+	t.strobe.Destroy()
 }
@@ -5,69 +5,45 @@
 package merlin
 
 import (
+	"bytes"
 	"encoding/hex"
-	"github.com/gtank/merlin"
+	"github.com/skoret/merlin/strobe"
 	"github.com/stretchr/testify/assert"
 	"io"
 	"math/rand"
+	"strconv"
 	"testing"
+	"testing/iotest"
 )
 
-func prt(t *testing.T, message string, t1 Transcript, t2 merlin.Transcript) {
-	t.Logf("%s:\n\t%+v\n\t%+v", message, t1, t2)
-	t.Log("---------------------------------------------------------------------------")
-}
-
-func TestEquivalenceSimple(t *testing.T) {
+func TestClone(t *testing.T) {
 	t1 := NewTranscript("test protocol")
-	t2 := merlin.NewTranscript("test protocol")
-	prt(t, "init", *t1, *t2)
+	t1.AppendMessage([]byte("commitment"), []byte("common commitment"))
 
-	t1.AppendMessage([]byte("test label"), []byte("test data"))
-	t2.AppendMessage([]byte("test label"), []byte("test data"))
-	prt(t, "add", *t1, *t2)
+	t2 := t1.Clone()
+	t3 := t1.Clone()
 
-	c1 := make([]byte, 32)
+	// the fork follows the original as long as the same data is appended
+	c1, c2, c3 := make([]byte, 32), make([]byte, 32), make([]byte, 32)
+	t1.AppendMessage([]byte("branch"), []byte("left"))
+	t2.AppendMessage([]byte("branch"), []byte("left"))
+	t3.AppendMessage([]byte("branch"), []byte("right"))
 	t1.ChallengeBytes([]byte("challenge"), c1)
-	c2 := t2.ExtractBytes([]byte("challenge"), 32)
-	prt(t, "challenge", *t1, *t2)
-
-	t.Logf("challenge bytes:\n\t%s\n\t%s", hex.EncodeToString(c1), hex.EncodeToString(c2))
+	t2.ChallengeBytes([]byte("challenge"), c2)
+	t3.ChallengeBytes([]byte("challenge"), c3)
 	assert.Equal(t, c1, c2)
-}
-
-func TestEquivalenceComplex(t *testing.T) {
-	t1 := NewTranscript("test protocol")
-	t2 := merlin.NewTranscript("test protocol")
-	prt(t, "init", *t1, *t2)
-
-	t1.AppendMessage([]byte("test label"), []byte("test data"))
-	t2.AppendMessage([]byte("test label"), []byte("test data"))
-	prt(t, "add", *t1, *t2)
-
-	lorem := make([]byte, 1024)
-	for i := range lorem {
-		lorem[i] = 239
-	}
-
-	var c1, c2 []byte = make([]byte, 32), nil
-
-	for i := 0; i < 32; i++ {
-		t1.ChallengeBytes([]byte("challenge"), c1)
-		c2 = t2.ExtractBytes([]byte("challenge"), 32)
+	assert.NotEqual(t, c1, c3)
 
-		assert.Equal(t, c1, c2)
-
-		t1.AppendMessage([]byte("lorem ipsum"), lorem)
-		t2.AppendMessage([]byte("lorem ipsum"), lorem)
-
-		t1.AppendMessage([]byte("challenge data"), lorem)
-		t2.AppendMessage([]byte("challenge data"), lorem)
-	}
+	// changes of the original don't leak into the fork and vice versa
+	t4 := t1.Clone()
+	t1.AppendMessage([]byte("original only"), []byte("data"))
+	t4.ChallengeBytes([]byte("challenge"), c2)
+	t5 := t1.Clone()
+	t1.ChallengeBytes([]byte("challenge"), c1)
+	assert.NotEqual(t, c1, c2)
 
-	prt(t, "final state", *t1, *t2)
-	t.Logf("challenge bytes:\n\t%s\n\t%s", hex.EncodeToString(c1), hex.EncodeToString(c2))
-	assert.Equal(t, c1, c2)
+	t5.ChallengeBytes([]byte("challenge"), c3)
+	assert.Equal(t, c1, c3)
 }
 
 func TestTranscriptRngBound(t *testing.T) {
@@ -103,6 +79,307 @@ func TestTranscriptRngBound(t *testing.T) {
 	t.Logf("%s4: %s", witness, hex.EncodeToString(s4))
 }
 
+func TestAppendMessageStream(t *testing.T) {
+	message := make([]byte, 10000)
+	rand.New(rand.NewSource(239)).Read(message)
+
+	for _, src := range []io.Reader{
+		bytes.NewReader(message),
+		iotest.OneByteReader(bytes.NewReader(message)),
+		iotest.HalfReader(bytes.NewReader(message)),
+		io.MultiReader(bytes.NewReader(message), bytes.NewReader([]byte("trailing data"))),
+	} {
+		t1 := NewTranscript("test protocol")
+		t2 := NewTranscript("test protocol")
+
+		t1.AppendMessage([]byte("commitment"), message)
+		assert.NoError(t, t2.AppendMessageStream([]byte("commitment"), len(message), src))
+
+		c1, c2 := make([]byte, 32), make([]byte, 32)
+		t1.ChallengeBytes([]byte("challenge"), c1)
+		t2.ChallengeBytes([]byte("challenge"), c2)
+		assert.Equal(t, c1, c2)
+	}
+
+	t1 := NewTranscript("test protocol")
+	t2 := NewTranscript("test protocol")
+	t1.AppendMessage([]byte("empty"), nil)
+	assert.NoError(t, t2.AppendMessageStream([]byte("empty"), 0, bytes.NewReader(nil)))
+	c1, c2 := make([]byte, 32), make([]byte, 32)
+	t1.ChallengeBytes([]byte("challenge"), c1)
+	t2.ChallengeBytes([]byte("challenge"), c2)
+	assert.Equal(t, c1, c2)
+
+	err := t2.AppendMessageStream([]byte("short"), len(message)+1, bytes.NewReader(message))
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+
+	broken := io.MultiReader(bytes.NewReader(message[:100]), iotest.ErrReader(io.ErrClosedPipe))
+	err = t2.AppendMessageStream([]byte("broken"), len(message), broken)
+	assert.Equal(t, io.ErrClosedPipe, err)
+}
+
+func TestRekeyWithWitnessStream(t *testing.T) {
+	witness := make([]byte, 1000)
+	rand.New(rand.NewSource(239)).Read(witness)
+
+	tr := NewTranscript("test protocol")
+	tr.AppendMessage([]byte("commitment"), []byte("commitment"))
+
+	b1, b2 := tr.BuildRng(), tr.BuildRng()
+	b1.RekeyWithWitness([]byte("witness"), witness)
+	err := b2.RekeyWithWitnessStream([]byte("witness"), len(witness), iotest.HalfReader(bytes.NewReader(witness)))
+	assert.NoError(t, err)
+
+	r1 := b1.Finalize(rand.New(rand.NewSource(239)))
+	r2 := b2.Finalize(rand.New(rand.NewSource(239)))
+	assert.Equal(t, generate(t, r1), generate(t, r2))
+}
+
+func TestBufferTooLarge(t *testing.T) {
+	tr := NewTranscript("test protocol")
+
+	assert.NoError(t, checkLength(0))
+	assert.ErrorIs(t, checkLength(-1), ErrBufferTooLarge)
+
+	// Try* variants act the same as panicking ones on valid buffers
+	t1 := NewTranscript("test protocol")
+	c1, c2 := make([]byte, 32), make([]byte, 32)
+	assert.NoError(t, tr.TryAppendMessage([]byte("test label"), []byte("test data")))
+	assert.NoError(t, tr.TryChallengeBytes([]byte("challenge"), c1))
+	t1.AppendMessage([]byte("test label"), []byte("test data"))
+	t1.ChallengeBytes([]byte("challenge"), c2)
+	assert.Equal(t, c1, c2)
+
+	if strconv.IntSize < 64 {
+		t.Skip("int can't exceed MaxBufferLength on 32-bit platforms")
+	}
+	max := uint64(MaxBufferLength)
+	huge := int(max + 1)
+
+	assert.NoError(t, checkLength(int(max)))
+	assert.ErrorIs(t, checkLength(huge), ErrBufferTooLarge)
+
+	err := tr.AppendMessageStream([]byte("huge"), huge, bytes.NewReader(nil))
+	assert.ErrorIs(t, err, ErrBufferTooLarge)
+	assert.EqualError(t, err, ErrBufferTooLarge.Error()+": 4294967296")
+
+	b := tr.BuildRng()
+	err = b.RekeyWithWitnessStream([]byte("huge"), huge, bytes.NewReader(nil))
+	assert.ErrorIs(t, err, ErrBufferTooLarge)
+
+	assert.PanicsWithError(t, ErrBufferTooLarge.Error()+": 4294967296", func() {
+		storeMeta(&tr.strobe, []byte("huge"), huge)
+	})
+}
+
+func TestTranscriptRngRead(t *testing.T) {
+	rng := rand.New(rand.NewSource(239))
+	r1 := build("label", "commitment", "witness", rng)
+	r2 := TranscriptRng{r1.strobe.Clone()}
+
+	// reads up to MaxBufferLength bytes are a single PRF call
+	for _, length := range []int{0, 1, 32, 1000} {
+		dest1, dest2 := make([]byte, length), make([]byte, length)
+		n, err := r1.Read(dest1)
+		assert.NoError(t, err)
+		assert.Equal(t, length, n)
+
+		r2.strobe.MetaAd(encodeU32(uint32(length)), false)
+		r2.strobe.Prf(dest2, false)
+		assert.Equal(t, dest2, dest1)
+	}
+
+	// longer reads are split into chunks
+	dest1, dest2 := make([]byte, 1000), make([]byte, 1000)
+	r1.read(dest1, 300)
+	for _, chunk := range [][]byte{dest2[:300], dest2[300:600], dest2[600:900], dest2[900:]} {
+		r2.strobe.MetaAd(encodeU32(uint32(len(chunk))), false)
+		r2.strobe.Prf(chunk, false)
+	}
+	assert.Equal(t, dest2, dest1)
+
+	// chunk of exactly the buffer size produces no empty tail
+	r1.read(dest1[:600], 300)
+	r2.read(dest2[:300], 300)
+	r2.read(dest2[300:600], 300)
+	assert.Equal(t, dest2, dest1)
+}
+
+func TestFinalizeE(t *testing.T) {
+	tr := NewTranscript("test protocol")
+	tr.AppendMessage([]byte("commitment"), []byte("commitment"))
+
+	// the same entropy gives the same rng
+	b1, b2 := tr.BuildRng(), tr.BuildRng()
+	r1, err := b1.FinalizeE(rand.New(rand.NewSource(239)))
+	assert.NoError(t, err)
+	r2 := b2.Finalize(rand.New(rand.NewSource(239)))
+	assert.Equal(t, generate(t, r1), generate(t, r2))
+
+	// crypto/rand is used by default
+	b3 := tr.BuildRng()
+	r3, err := b3.FinalizeE(nil)
+	assert.NoError(t, err)
+	assert.NotEqual(t, generate(t, r1), generate(t, r3))
+
+	// failing and short rngs are rejected, the builder stays intact
+	b4 := tr.BuildRng()
+	_, err = b4.FinalizeE(iotest.ErrReader(io.ErrClosedPipe))
+	assert.ErrorIs(t, err, io.ErrClosedPipe)
+	_, err = b4.FinalizeE(bytes.NewReader(make([]byte, 31)))
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	_, err = b4.FinalizeE(bytes.NewReader(nil))
+	assert.ErrorIs(t, err, io.EOF)
+	assert.Panics(t, func() {
+		b4.Finalize(iotest.ErrReader(io.ErrClosedPipe))
+	})
+
+	r4, err := b4.FinalizeE(iotest.OneByteReader(rand.New(rand.NewSource(239))))
+	assert.NoError(t, err)
+	b5 := tr.BuildRng()
+	r5 := b5.Finalize(rand.New(rand.NewSource(239)))
+	assert.Equal(t, generate(t, r5), generate(t, r4))
+}
+
+func TestRatchet(t *testing.T) {
+	t1 := NewTranscript("test protocol")
+	t2 := NewTranscript("test protocol")
+	t3 := NewTranscript("test protocol")
+
+	c1, c2, c3 := make([]byte, 32), make([]byte, 32), make([]byte, 32)
+	for _, tr := range []*Transcript{t1, t2, t3} {
+		tr.AppendMessage([]byte("test label"), []byte("test data"))
+	}
+
+	t1.Ratchet([]byte("ratchet"))
+	t2.Ratchet([]byte("ratchet"))
+	t1.ChallengeBytes([]byte("challenge"), c1)
+	t2.ChallengeBytes([]byte("challenge"), c2)
+	t3.ChallengeBytes([]byte("challenge"), c3)
+
+	assert.Equal(t, c1, c2)
+	assert.NotEqual(t, c1, c3)
+}
+
+func TestTranscriptRngRatchet(t *testing.T) {
+	rng := rand.New(rand.NewSource(239))
+	r1 := build("label", "commitment", "witness", rng)
+	r2 := *r1
+	r2.strobe = r1.strobe.Clone()
+
+	s1 := generate(t, r1)
+	s2 := generate(t, &r2)
+	assert.Equal(t, s1, s2)
+
+	r1.Ratchet()
+	s1 = generate(t, r1)
+	s2 = generate(t, &r2)
+	assert.NotEqual(t, s1, s2)
+}
+
+func TestDestroy(t *testing.T) {
+	tr := NewTranscript("test protocol")
+	tr.AppendMessage([]byte("commitment"), []byte("commitment"))
+	b := tr.BuildRng()
+	b.RekeyWithWitness([]byte("witness"), []byte("witness"))
+	r := b.Finalize(rand.New(rand.NewSource(239)))
+	b = tr.BuildRng()
+
+	tr.Destroy()
+	assert.PanicsWithValue(t, strobe.ErrDestroyed, func() { tr.AppendMessage([]byte("label"), []byte("data")) })
+	assert.PanicsWithValue(t, strobe.ErrDestroyed, func() { tr.ChallengeBytes([]byte("label"), make([]byte, 32)) })
+	assert.PanicsWithValue(t, strobe.ErrDestroyed, func() { tr.Ratchet([]byte("label")) })
+	assert.ErrorIs(t, tr.TryAppendMessage([]byte("label"), []byte("data")), strobe.ErrDestroyed)
+	assert.ErrorIs(t, tr.TryChallengeBytes([]byte("label"), make([]byte, 32)), strobe.ErrDestroyed)
+	assert.ErrorIs(t, tr.AppendMessageStream([]byte("label"), 4, bytes.NewReader([]byte("data"))), strobe.ErrDestroyed)
+	_, err := tr.MarshalBinary()
+	assert.ErrorIs(t, err, strobe.ErrDestroyed)
+	destroyed := tr.BuildRng()
+	assert.PanicsWithValue(t, strobe.ErrDestroyed, func() { destroyed.RekeyWithWitness([]byte("witness"), []byte("witness")) })
+
+	// the builder and the rng made before are independent
+	r.Read(make([]byte, 32))
+	b.Destroy()
+	assert.PanicsWithValue(t, strobe.ErrDestroyed, func() { b.RekeyWithWitness([]byte("witness"), []byte("witness")) })
+	assert.ErrorIs(t, b.RekeyWithWitnessStream([]byte("witness"), 7, bytes.NewReader([]byte("witness"))), strobe.ErrDestroyed)
+	assert.ErrorIs(t, b.TryRekeyWithWitness([]byte("witness"), []byte("witness")), strobe.ErrDestroyed)
+	_, err = b.FinalizeE(nil)
+	assert.ErrorIs(t, err, strobe.ErrDestroyed)
+	assert.PanicsWithValue(t, strobe.ErrDestroyed, func() { b.Finalize(nil) })
+
+	r.Destroy()
+	n, err := r.Read(make([]byte, 32))
+	assert.Equal(t, 0, n)
+	assert.ErrorIs(t, err, strobe.ErrDestroyed)
+	assert.PanicsWithValue(t, strobe.ErrDestroyed, func() { r.Ratchet() })
+	_, err = r.MarshalBinary()
+	assert.ErrorIs(t, err, strobe.ErrDestroyed)
+}
+
+// Rng that keeps the buffers it filled
+type retainingReader struct {
+	buffers [][]byte
+}
+
+func (r *retainingReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0xff
+	}
+	r.buffers = append(r.buffers, p)
+	return len(p), nil
+}
+
+func TestFinalizeWipesEntropy(t *testing.T) {
+	rng := &retainingReader{}
+	b := NewTranscript("test protocol").BuildRng()
+	b.Finalize(rng)
+
+	assert.NotEmpty(t, rng.buffers)
+	for _, buf := range rng.buffers {
+		assert.Equal(t, make([]byte, len(buf)), buf)
+	}
+}
+
+func TestBuilderFinalized(t *testing.T) {
+	tr := NewTranscript("test protocol")
+	tr.AppendMessage([]byte("commitment"), []byte("commitment"))
+	b := tr.BuildRng()
+	assert.NoError(t, b.TryRekeyWithWitness([]byte("witness"), []byte("witness")))
+	r := b.Finalize(rand.New(rand.NewSource(239)))
+
+	// the builder state is wiped, but the rng keeps working
+	assert.True(t, b.strobe.Destroyed())
+	assert.Equal(t, generate(t, build("test protocol", "commitment", "witness", rand.New(rand.NewSource(239)))), generate(t, r))
+
+	// finalize twice
+	_, err := b.FinalizeE(rand.New(rand.NewSource(239)))
+	assert.ErrorIs(t, err, ErrBuilderFinalized)
+	assert.PanicsWithValue(t, ErrBuilderFinalized, func() { b.Finalize(rand.New(rand.NewSource(239))) })
+
+	// rekey after finalize
+	assert.PanicsWithValue(t, ErrBuilderFinalized, func() { b.RekeyWithWitness([]byte("witness"), []byte("witness")) })
+	assert.ErrorIs(t, b.TryRekeyWithWitness([]byte("witness"), []byte("witness")), ErrBuilderFinalized)
+	err = b.RekeyWithWitnessStream([]byte("witness"), 7, bytes.NewReader([]byte("witness")))
+	assert.ErrorIs(t, err, ErrBuilderFinalized)
+
+	// copies of the builder reference share the lifecycle
+	b = tr.BuildRng()
+	c := b
+	b.RekeyWithWitness([]byte("witness"), []byte("witness"))
+	b.Finalize(rand.New(rand.NewSource(239)))
+	_, err = c.FinalizeE(rand.New(rand.NewSource(239)))
+	assert.ErrorIs(t, err, ErrBuilderFinalized)
+
+	// failed finalize doesn't finalize the builder
+	b = tr.BuildRng()
+	_, err = b.FinalizeE(iotest.ErrReader(io.ErrClosedPipe))
+	assert.ErrorIs(t, err, io.ErrClosedPipe)
+	assert.NoError(t, b.TryRekeyWithWitness([]byte("witness"), []byte("witness")))
+	_, err = b.FinalizeE(rand.New(rand.NewSource(239)))
+	assert.NoError(t, err)
+	assert.ErrorIs(t, b.TryRekeyWithWitness([]byte("witness"), []byte("witness")), ErrBuilderFinalized)
+}
+
 func build(label, commitment, witness string, rng io.Reader) *TranscriptRng {
 	t := NewTranscript(label)
 	t.AppendMessage([]byte("commitment"), []byte(commitment))
@@ -121,3 +398,45 @@ func generate(t *testing.T, rnd io.Reader) []byte {
 	assert.Equal(t, 32, n)
 	return dest
 }
+
+func BenchmarkNewTranscript(b *testing.B) {
+	b.Run("Mini", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			NewTranscript("test protocol")
+		}
+	})
+}
+
+func BenchmarkAppendMessage(b *testing.B) {
+	for _, size := range []struct {
+		name string
+		size int
+	}{
+		{"32B", 32},
+		{"1KiB", 1 << 10},
+		{"1MiB", 1 << 20},
+	} {
+		message := make([]byte, size.size)
+
+		b.Run("Mini/"+size.name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(message)))
+			t := NewTranscript("test protocol")
+			for i := 0; i < b.N; i++ {
+				t.AppendMessage([]byte("message"), message)
+			}
+		})
+	}
+}
+
+func BenchmarkChallengeBytes(b *testing.B) {
+	b.Run("Mini", func(b *testing.B) {
+		b.ReportAllocs()
+		t := NewTranscript("test protocol")
+		challenge := make([]byte, 32)
+		for i := 0; i < b.N; i++ {
+			t.ChallengeBytes([]byte("challenge"), challenge)
+		}
+	})
+}
@@ -0,0 +1,92 @@
+// Copyright © 2019. Sergey Skaredov.
+// Licensed under the MIT License.
+// See LICENSE.txt for details.
+
+package merlin
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+)
+
+// Operation recorded on a transcript: Op is one of "init", "append",
+// "challenge", "ratchet", "clone", "rekey" or "finalize", Hash is SHA-256 of the
+// data. Label of "init" is the protocol label given to the transcript, not
+// DomainSeparator. Witnesses and rng entropy are secret, so Hash is left zero
+// for "rekey" and "finalize"
+type Operation struct {
+	Op     string
+	Label  string
+	Length int
+	Hash   [sha256.Size]byte
+}
+
+func (op Operation) String() string {
+	return fmt.Sprintf("%s(%q, %d) %s", op.Op, op.Label, op.Length, hex.EncodeToString(op.Hash[:]))
+}
+
+// Recorder receives every operation run on a transcript,
+// see NewTranscriptWithRecorder
+type Recorder interface {
+	Record(op Operation)
+}
+
+// Recording is a Recorder that keeps operations in memory
+type Recording []Operation
+
+func (r *Recording) Record(op Operation) {
+	*r = append(*r, op)
+}
+
+// Find the first operation that differs in a and b, e.g. to compare
+// prover and verifier transcripts, returns -1 if they are the same.
+// If one is a prefix of the other, the length of the shorter is returned
+func Diff(a, b []Operation) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	if len(a) != len(b) {
+		return min(len(a), len(b))
+	}
+	return -1
+}
+
+func record(r Recorder, op string, label []byte, data []byte) {
+	if r != nil {
+		r.Record(Operation{op, string(label), len(data), sha256.Sum256(data)})
+	}
+}
+
+// Record an operation without data or with secret data
+func recordLength(r Recorder, op string, label []byte, length int) {
+	if r != nil {
+		r.Record(Operation{Op: op, Label: string(label), Length: length})
+	}
+}
+
+// Hash data read by a stream operation, see AppendMessageStream
+type recordingReader struct {
+	io.Reader
+	hash hash.Hash
+}
+
+func newRecordingReader(r Recorder, src io.Reader) *recordingReader {
+	if r == nil {
+		return &recordingReader{Reader: src}
+	}
+	h := sha256.New()
+	return &recordingReader{io.TeeReader(src, h), h}
+}
+
+func (rr *recordingReader) record(r Recorder, op string, label []byte, length int) {
+	if r != nil {
+		o := Operation{Op: op, Label: string(label), Length: length}
+		rr.hash.Sum(o.Hash[:0])
+		r.Record(o)
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright © 2019. Sergey Skaredov.
+// Licensed under the MIT License.
+// See LICENSE.txt for details.
+
+package merlin
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"testing"
+)
+
+func TestRecorder(t *testing.T) {
+	var prover, verifier Recording
+	t1 := NewTranscriptWithRecorder("test protocol", &prover)
+	t2 := NewTranscriptWithRecorder("test protocol", &verifier)
+
+	t1.AppendMessage([]byte("commitment"), []byte("commitment"))
+	assert.NoError(t, t2.AppendMessageStream([]byte("commitment"), 10, bytes.NewReader([]byte("commitment"))))
+	t1.AppendU64([]byte("round"), 1)
+	t2.AppendU64([]byte("round"), 2)
+	for _, tr := range []*Transcript{t1, t2} {
+		tr.ChallengeBytes([]byte("challenge"), make([]byte, 32))
+		tr.Ratchet([]byte("ratchet"))
+	}
+
+	assert.Equal(t, []Operation{
+		{"init", "test protocol", 13, sha256.Sum256([]byte("test protocol"))},
+		{"append", "commitment", 10, sha256.Sum256([]byte("commitment"))},
+		{"append", "round", 8, sha256.Sum256(encodeU64(1))},
+		{"challenge", "challenge", 32, prover[3].Hash},
+		{"ratchet", "ratchet", 32, [sha256.Size]byte{}},
+	}, []Operation(prover))
+	assert.Equal(t, 2, Diff(prover, verifier))
+	assert.Equal(t, -1, Diff(prover[:2], verifier[:2]))
+	assert.Equal(t, 1, Diff(prover[:1], verifier))
+	assert.Equal(t, 1, Diff(prover, verifier[:1]))
+	assert.Equal(t, -1, Diff(nil, nil))
+	t.Logf("first diverging operation:\n\t%s\n\t%s", prover[2], verifier[2])
+
+	// clones share the recorder unless given their own
+	t1.Clone().AppendMessage([]byte("clone"), nil)
+	var fork Recording
+	t1.CloneWithRecorder(&fork).AppendMessage([]byte("fork"), nil)
+	assert.Equal(t, []Operation{
+		{Op: "clone"},
+		{"append", "clone", 0, sha256.Sum256(nil)},
+		{Op: "clone"},
+	}, []Operation(prover[5:]))
+	assert.Equal(t, []Operation{
+		{Op: "clone"},
+		{"append", "fork", 0, sha256.Sum256(nil)},
+	}, []Operation(fork))
+	prover = prover[:5]
+
+	// mismatched protocol labels are readable
+	var other Recording
+	NewTranscriptWithRecorder("other protocol", &other)
+	assert.Equal(t, 0, Diff(prover, other))
+	assert.Contains(t, other[0].String(), `init("other protocol", 14)`)
+
+	// witnesses and entropy are secret, their hashes aren't recorded
+	b := t1.BuildRng()
+	b.RekeyWithWitness([]byte("witness"), []byte("witness"))
+	assert.NoError(t, b.TryRekeyWithWitness([]byte("witness"), []byte("witness")))
+	assert.NoError(t, b.RekeyWithWitnessStream([]byte("witness"), 7, bytes.NewReader([]byte("witness"))))
+	b.Finalize(rand.New(rand.NewSource(239)))
+	assert.Equal(t, []Operation{
+		{Op: "rekey", Label: "witness", Length: 7},
+		{Op: "rekey", Label: "witness", Length: 7},
+		{Op: "rekey", Label: "witness", Length: 7},
+		{Op: "finalize", Label: "rng", Length: 32},
+	}, []Operation(prover[5:]))
+}
+
+func TestRecorderAppendStruct(t *testing.T) {
+	type message struct {
+		Name  string `merlin:"name"`
+		Value *int   `merlin:"value"`
+	}
+
+	var ops Recording
+	tr := NewTranscriptWithRecorder("test protocol", &ops)
+
+	// nothing is recorded on errors
+	assert.Error(t, AppendStruct(tr, message{Name: "name"}))
+	assert.Len(t, ops, 1)
+
+	value := 239
+	assert.NoError(t, AppendStruct(tr, message{"name", &value}))
+	assert.Equal(t, []Operation{
+		{"append", "name", 4, sha256.Sum256([]byte("name"))},
+		{"append", "value", 8, sha256.Sum256(encodeU64(239))},
+	}, []Operation(ops[1:]))
+
+	// transcripts without recorders are supported too
+	assert.NoError(t, AppendStruct(NewTranscript("test protocol"), message{"name", &value}))
+}
@@ -0,0 +1,80 @@
+// Copyright © 2019. Sergey Skaredov.
+// Licensed under the MIT License.
+// See LICENSE.txt for details.
+
+package strobe
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+)
+
+// Serialized Strobe layout, version 1:
+//
+//	version || b/8 || rate || flags || I0 || pos || posBegin || state || CRC32(everything before)
+//
+// CRC-32 (IEEE) detects accidental corruption only, it isn't a MAC:
+// serialized state is as secret as the Strobe itself.
+const (
+	encodingVersion    = 1
+	encodingHeaderSize = 7
+	encodingCrcSize    = 4
+)
+
+var ErrInvalidEncoding = errors.New("strobe: invalid encoding")
+
+// Implement encoding.BinaryMarshaler
+func (s *Strobe) MarshalBinary() ([]byte, error) {
+	if s.Destroyed() {
+		return nil, ErrDestroyed
+	}
+	data := make([]byte, 0, encodingHeaderSize+int(s.size)+encodingCrcSize)
+	data = append(data, encodingVersion, s.size, s.rate, byte(s.flags), byte(s.i0), s.pos, s.posBegin)
+	data = append(data, s.bytes()[:s.size]...)
+
+	var crc [encodingCrcSize]byte
+	binary.LittleEndian.PutUint32(crc[:], crc32.ChecksumIEEE(data))
+	return append(data, crc[:]...), nil
+}
+
+// Implement encoding.BinaryUnmarshaler,
+// s is left untouched if data isn't a valid serialized Strobe
+func (s *Strobe) UnmarshalBinary(data []byte) error {
+	if len(data) < encodingHeaderSize+encodingCrcSize {
+		return fmt.Errorf("%w: too short", ErrInvalidEncoding)
+	}
+	body, crc := data[:len(data)-encodingCrcSize], data[len(data)-encodingCrcSize:]
+	if crc32.ChecksumIEEE(body) != binary.LittleEndian.Uint32(crc) {
+		return fmt.Errorf("%w: checksum mismatch", ErrInvalidEncoding)
+	}
+	if body[0] != encodingVersion {
+		return fmt.Errorf("%w: unsupported version %d", ErrInvalidEncoding, body[0])
+	}
+
+	size, rate, flags, i0, pos, posBegin := int(body[1]), body[2], flag(body[3]), role(body[4]), body[5], body[6]
+	if len(body) != encodingHeaderSize+size {
+		return fmt.Errorf("%w: wrong length", ErrInvalidEncoding)
+	}
+	if size != 400/8 && size != 800/8 && size != 1600/8 {
+		return fmt.Errorf("%w: unsupported keccak-f[%d]", ErrInvalidEncoding, size*8)
+	}
+	if int(rate) != size-128/4-2 && int(rate) != size-256/4-2 {
+		return fmt.Errorf("%w: unsupported rate %d", ErrInvalidEncoding, rate)
+	}
+	if pos >= rate || posBegin > pos || flags > flagI|flagA|flagC|flagT|flagM || i0 > roleResponder {
+		return fmt.Errorf("%w: inconsistent state", ErrInvalidEncoding)
+	}
+
+	*s = Strobe{
+		flags:    flags,
+		i0:       i0,
+		size:     uint8(size),
+		rate:     rate,
+		pos:      pos,
+		posBegin: posBegin,
+	}
+	copy(s.bytes()[:], body[encodingHeaderSize:])
+	return nil
+}
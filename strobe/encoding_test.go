@@ -0,0 +1,81 @@
+// Copyright © 2019. Sergey Skaredov.
+// Licensed under the MIT License.
+// See LICENSE.txt for details.
+
+package strobe
+
+import (
+	"encoding/binary"
+	"github.com/stretchr/testify/assert"
+	"hash/crc32"
+	"testing"
+)
+
+func TestMarshalBinary(t *testing.T) {
+	data := []byte(" very long data to force F: AAAAAAOOOOOOOOOAAAOAOAOAOAOAO, mmmmmmmmmmmmmmmmm")
+
+	for _, params := range [][2]int{{1600, 128}, {1600, 256}, {800, 128}, {400, 128}} {
+		s1 := NewStrobeWithParams(t.Name(), params[0], params[1])
+		s1.Key([]byte("secret key"), false)
+		s1.RecvClr(data, false)
+		s1.Ad(data[:10], false)
+
+		encoded, err := s1.MarshalBinary()
+		assert.NoError(t, err)
+		assert.Len(t, encoded, encodingHeaderSize+params[0]/8+encodingCrcSize)
+
+		var s2 Strobe
+		assert.NoError(t, s2.UnmarshalBinary(encoded))
+
+		// continuation and role are restored too
+		s1.Ad(data[10:], true)
+		s2.Ad(data[10:], true)
+		s1.SendClr(data, false)
+		s2.SendClr(data, false)
+
+		prf1, prf2 := make([]byte, 32), make([]byte, 32)
+		s1.Prf(prf1, false)
+		s2.Prf(prf2, false)
+		assert.Equal(t, prf1, prf2, "prf returned bytes aren't the same")
+		assert.Equal(t, s1.state, s2.state)
+	}
+}
+
+func TestUnmarshalBinaryInvalid(t *testing.T) {
+	s := NewStrobe(t.Name())
+	encoded, _ := s.MarshalBinary()
+
+	// fix up the checksum to get past the integrity check
+	reseal := func(data []byte) []byte {
+		body := data[:len(data)-encodingCrcSize]
+		binary.LittleEndian.PutUint32(data[len(body):], crc32.ChecksumIEEE(body))
+		return data
+	}
+	mutate := func(i int, value byte) []byte {
+		data := append([]byte{}, encoded...)
+		data[i] = value
+		return reseal(data)
+	}
+
+	corrupted := append([]byte{}, encoded...)
+	corrupted[encodingHeaderSize+3] ^= 1
+
+	for name, data := range map[string][]byte{
+		"empty":        nil,
+		"truncated":    encoded[:len(encoded)-1],
+		"corrupted":    corrupted,
+		"version":      mutate(0, encodingVersion+1),
+		"length":       reseal(append(append([]byte{}, encoded[:len(encoded)-encodingCrcSize]...), 0, 0, 0, 0, 0)),
+		"keccak width": mutate(1, 150),
+		"rate":         mutate(2, 100),
+		"flags":        mutate(3, byte(flagK)),
+		"role":         mutate(4, byte(roleResponder+1)),
+		"pos":          mutate(5, s.rate),
+		"pos begin":    mutate(6, s.pos+1),
+	} {
+		restored := NewStrobe(t.Name())
+		err := restored.UnmarshalBinary(data)
+		assert.ErrorIs(t, err, ErrInvalidEncoding, name)
+		assert.Equal(t, s.state, restored.state, name)
+	}
+}
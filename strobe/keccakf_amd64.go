@@ -2,6 +2,7 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
+//go:build amd64 && !appengine && !gccgo
 // +build amd64,!appengine,!gccgo
 
 package strobe
@@ -10,4 +11,4 @@ package strobe
 
 //go:noescape
 
-func keccakF1600(a *[25]uint64)
+func keccakF1600(state *[25]uint64)
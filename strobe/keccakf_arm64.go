@@ -0,0 +1,29 @@
+// Copyright © 2019. Sergey Skaredov.
+// Licensed under the MIT License.
+// See LICENSE.txt for details.
+
+//go:build arm64 && !appengine && !gccgo
+// +build arm64,!appengine,!gccgo
+
+package strobe
+
+import "golang.org/x/sys/cpu"
+
+// useSHA3 is detected at runtime: ARMv8.2 SHA3 extension is optional,
+// e.g. it's present on Apple M1 and AWS Graviton3, but not on Graviton2.
+// Without it keccak-f[1600] falls back to the generic implementation.
+// golang.org/x/sys/cpu is the only external runtime dependency, see README.md
+var useSHA3 = cpu.ARM64.HasSHA3
+
+// This function is implemented in keccakf_arm64.s.
+
+//go:noescape
+func keccakF1600SHA3(a *[25]uint64)
+
+func keccakF1600(a *[25]uint64) {
+	if useSHA3 {
+		keccakF1600SHA3(a)
+	} else {
+		keccakF1600Generic(a)
+	}
+}
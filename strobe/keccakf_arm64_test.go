@@ -0,0 +1,48 @@
+// Copyright © 2019. Sergey Skaredov.
+// Licensed under the MIT License.
+// See LICENSE.txt for details.
+
+//go:build arm64 && !appengine && !gccgo
+// +build arm64,!appengine,!gccgo
+
+package strobe
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"testing"
+)
+
+// Run natively on arm64 or under qemu-user with SHA3 enabled, e.g.
+//
+//	GOARCH=arm64 go test -exec 'qemu-aarch64 -cpu max' ./strobe
+func TestKeccakF1600SHA3(t *testing.T) {
+	if !useSHA3 {
+		t.Skip("SHA3 extension is not available")
+	}
+	rng := rand.New(rand.NewSource(239))
+
+	for i := 0; i < 100; i++ {
+		var a, expected [25]uint64
+		for j := range a {
+			a[j] = rng.Uint64()
+		}
+		expected = a
+
+		keccakF1600SHA3(&a)
+		keccakF1600Generic(&expected)
+		assert.Equal(t, expected, a)
+	}
+}
+
+func BenchmarkKeccakF1600SHA3(b *testing.B) {
+	if !useSHA3 {
+		b.Skip("SHA3 extension is not available")
+	}
+	var a [25]uint64
+	b.ReportAllocs()
+	b.SetBytes(int64(len(a) * 8))
+	for i := 0; i < b.N; i++ {
+		keccakF1600SHA3(&a)
+	}
+}
@@ -0,0 +1,13 @@
+// Copyright © 2019. Sergey Skaredov.
+// Licensed under the MIT License.
+// See LICENSE.txt for details.
+
+//go:build (!amd64 && !arm64) || appengine || gccgo
+// +build !amd64,!arm64 appengine gccgo
+
+package strobe
+
+// There is no assembly implementation for this platform.
+func keccakF1600(a *[25]uint64) {
+	keccakF1600Generic(a)
+}
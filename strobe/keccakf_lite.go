@@ -0,0 +1,153 @@
+// Copyright © 2019. Sergey Skaredov.
+// Licensed under the MIT License.
+// See LICENSE.txt for details.
+
+package strobe
+
+import "math/bits"
+
+// Keccak-f[800] and Keccak-f[400] permutations used by STROBE-lite,
+// translated from the compact keccakf in tiny_sha3 (Markku-Juhani O. Saarinen):
+//	https://github.com/mjosaarinen/tiny_sha3
+// Round constants are the ones of keccak-f[1600] truncated to the lane size,
+// rotation offsets are taken modulo the lane size.
+
+// rotc stores the ρ step rotation offsets and piln the π step lane order
+var (
+	rotc = [24]int{1, 3, 6, 10, 15, 21, 28, 36, 45, 55, 2, 14, 27, 41, 56, 8, 25, 43, 62, 18, 39, 61, 20, 44}
+	piln = [24]int{10, 7, 11, 17, 18, 3, 5, 16, 8, 21, 24, 4, 15, 23, 19, 13, 12, 2, 20, 14, 22, 9, 6, 1}
+)
+
+// rc800 stores the round constants of keccak-f[800], 12 + 2*5 rounds
+var rc800 = [22]uint32{
+	0x00000001,
+	0x00008082,
+	0x0000808A,
+	0x80008000,
+	0x0000808B,
+	0x80000001,
+	0x80008081,
+	0x00008009,
+	0x0000008A,
+	0x00000088,
+	0x80008009,
+	0x8000000A,
+	0x8000808B,
+	0x0000008B,
+	0x00008089,
+	0x00008003,
+	0x00008002,
+	0x00000080,
+	0x0000800A,
+	0x8000000A,
+	0x80008081,
+	0x00008080,
+}
+
+// rc400 stores the round constants of keccak-f[400], 12 + 2*4 rounds
+var rc400 = [20]uint16{
+	0x0001,
+	0x8082,
+	0x808A,
+	0x8000,
+	0x808B,
+	0x0001,
+	0x8081,
+	0x8009,
+	0x008A,
+	0x0088,
+	0x8009,
+	0x000A,
+	0x808B,
+	0x008B,
+	0x8089,
+	0x8003,
+	0x8002,
+	0x0080,
+	0x800A,
+	0x000A,
+}
+
+// keccakF800 applies the Keccak permutation to a 800b-wide
+// state represented as a slice of 25 uint32s.
+func keccakF800(a *[25]uint32) {
+	var t uint32
+	var bc [5]uint32
+
+	for r := range rc800 {
+		// θ step
+		for i := 0; i < 5; i++ {
+			bc[i] = a[i] ^ a[i+5] ^ a[i+10] ^ a[i+15] ^ a[i+20]
+		}
+		for i := 0; i < 5; i++ {
+			t = bc[(i+4)%5] ^ bits.RotateLeft32(bc[(i+1)%5], 1)
+			for j := 0; j < 25; j += 5 {
+				a[j+i] ^= t
+			}
+		}
+
+		// ρ and π steps
+		t = a[1]
+		for i := 0; i < 24; i++ {
+			j := piln[i]
+			bc[0] = a[j]
+			a[j] = bits.RotateLeft32(t, rotc[i])
+			t = bc[0]
+		}
+
+		// χ step
+		for j := 0; j < 25; j += 5 {
+			for i := 0; i < 5; i++ {
+				bc[i] = a[j+i]
+			}
+			for i := 0; i < 5; i++ {
+				a[j+i] ^= ^bc[(i+1)%5] & bc[(i+2)%5]
+			}
+		}
+
+		// ι step
+		a[0] ^= rc800[r]
+	}
+}
+
+// keccakF400 applies the Keccak permutation to a 400b-wide
+// state represented as a slice of 25 uint16s.
+func keccakF400(a *[25]uint16) {
+	var t uint16
+	var bc [5]uint16
+
+	for r := range rc400 {
+		// θ step
+		for i := 0; i < 5; i++ {
+			bc[i] = a[i] ^ a[i+5] ^ a[i+10] ^ a[i+15] ^ a[i+20]
+		}
+		for i := 0; i < 5; i++ {
+			t = bc[(i+4)%5] ^ bits.RotateLeft16(bc[(i+1)%5], 1)
+			for j := 0; j < 25; j += 5 {
+				a[j+i] ^= t
+			}
+		}
+
+		// ρ and π steps
+		t = a[1]
+		for i := 0; i < 24; i++ {
+			j := piln[i]
+			bc[0] = a[j]
+			a[j] = bits.RotateLeft16(t, rotc[i])
+			t = bc[0]
+		}
+
+		// χ step
+		for j := 0; j < 25; j += 5 {
+			for i := 0; i < 5; i++ {
+				bc[i] = a[j+i]
+			}
+			for i := 0; i < 5; i++ {
+				a[j+i] ^= ^bc[(i+1)%5] & bc[(i+2)%5]
+			}
+		}
+
+		// ι step
+		a[0] ^= rc400[r]
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright © 2019. Sergey Skaredov.
+// Licensed under the MIT License.
+// See LICENSE.txt for details.
+
+package strobe
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// Straightforward keccak-f[25*w] from the Keccak reference, section 1.2:
+// rotation offsets and round constants are generated instead of tabulated
+func referenceKeccakF(a *[25]uint64, w uint) {
+	mask := ^uint64(0) >> (64 - w)
+	rot := func(x uint64, n uint) uint64 {
+		n %= w
+		return (x<<n | x>>(w-n)) & mask
+	}
+
+	var offsets [25]uint
+	for t, x, y := 0, 1, 0; t < 24; t++ {
+		offsets[x+5*y] = uint((t + 1) * (t + 2) / 2)
+		x, y = y, (2*x+3*y)%5
+	}
+
+	lfsr := uint8(1)
+	rcBit := func() uint64 {
+		bit := uint64(lfsr & 1)
+		if lfsr&0x80 != 0 {
+			lfsr = lfsr<<1 ^ 0x71
+		} else {
+			lfsr <<= 1
+		}
+		return bit
+	}
+
+	l := map[uint]int{16: 4, 32: 5, 64: 6}[w]
+	for round := 0; round < 12+2*l; round++ {
+		var c, d [5]uint64
+		for x := 0; x < 5; x++ {
+			c[x] = a[x] ^ a[x+5] ^ a[x+10] ^ a[x+15] ^ a[x+20]
+		}
+		for x := 0; x < 5; x++ {
+			d[x] = c[(x+4)%5] ^ rot(c[(x+1)%5], 1)
+		}
+		for i := range a {
+			a[i] ^= d[i%5]
+		}
+
+		var b [25]uint64
+		for x := 0; x < 5; x++ {
+			for y := 0; y < 5; y++ {
+				b[y+5*((2*x+3*y)%5)] = rot(a[x+5*y], offsets[x+5*y])
+			}
+		}
+		for x := 0; x < 5; x++ {
+			for y := 0; y < 5; y++ {
+				a[x+5*y] = b[x+5*y] ^ (^b[(x+1)%5+5*y] & b[(x+2)%5+5*y] & mask)
+			}
+		}
+
+		var rc uint64
+		for j := uint(0); j < 7; j++ {
+			rc |= rcBit() << (1<<j - 1)
+		}
+		a[0] ^= rc & mask
+	}
+}
+
+func TestReferenceKeccakF1600(t *testing.T) {
+	var a, expected [25]uint64
+	for i := range a {
+		a[i] = uint64(i) * 0x9e3779b97f4a7c15
+	}
+	expected = a
+
+	for i := 0; i < 3; i++ {
+		keccakF1600(&expected)
+		referenceKeccakF(&a, 64)
+	}
+	assert.Equal(t, expected, a)
+}
+
+func TestKeccakF800(t *testing.T) {
+	var a [25]uint32
+	var expected [25]uint64
+	for i := range a {
+		a[i] = uint32(i) * 0x9e3779b9
+		expected[i] = uint64(a[i])
+	}
+
+	for i := 0; i < 3; i++ {
+		keccakF800(&a)
+		referenceKeccakF(&expected, 32)
+		for j := range a {
+			assert.Equal(t, expected[j], uint64(a[j]), "lanes aren't the same")
+		}
+	}
+}
+
+func TestKeccakF400(t *testing.T) {
+	var a [25]uint16
+	var expected [25]uint64
+	for i := range a {
+		a[i] = uint16(i) * 0x9e37
+		expected[i] = uint64(a[i])
+	}
+
+	for i := 0; i < 3; i++ {
+		keccakF400(&a)
+		referenceKeccakF(&expected, 16)
+		for j := range a {
+			assert.Equal(t, expected[j], uint64(a[j]), "lanes aren't the same")
+		}
+	}
+}
@@ -0,0 +1,47 @@
+// Copyright © 2019. Sergey Skaredov.
+// Licensed under the MIT License.
+// See LICENSE.txt for details.
+
+package strobe
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"testing"
+)
+
+// keccakF1600 may be an assembly implementation, check it against the generic one
+func TestKeccakF1600(t *testing.T) {
+	rng := rand.New(rand.NewSource(239))
+
+	for i := 0; i < 100; i++ {
+		var a, expected [25]uint64
+		for j := range a {
+			a[j] = rng.Uint64()
+		}
+		expected = a
+
+		keccakF1600(&a)
+		keccakF1600Generic(&expected)
+		assert.Equal(t, expected, a)
+	}
+}
+
+func BenchmarkKeccakF1600(b *testing.B) {
+	var a [25]uint64
+
+	b.Run("Generic", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(a) * 8))
+		for i := 0; i < b.N; i++ {
+			keccakF1600Generic(&a)
+		}
+	})
+	b.Run("Platform", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(a) * 8))
+		for i := 0; i < b.N; i++ {
+			keccakF1600(&a)
+		}
+	})
+}
@@ -0,0 +1,76 @@
+// Copyright © 2019. Sergey Skaredov.
+// Licensed under the MIT License.
+// See LICENSE.txt for details.
+
+package strobe
+
+import (
+	"math/bits"
+	"unsafe"
+)
+
+// Strobe keeps a single copy of keccak-f state: lanes in s.state
+// and the byte view of the same memory, so nothing is copied around
+// the permutation. Keccak lanes are little-endian, so the byte view
+// is valid as is on little-endian platforms, while on big-endian ones
+// lanes are byte swapped right before and after the permutation.
+var littleEndian = func() bool {
+	x := uint16(1)
+	return *(*byte)(unsafe.Pointer(&x)) == 1
+}()
+
+// Byte view of the state, only the first s.size bytes are in use
+func (s *Strobe) bytes() *[KeccakBlockSize * 8]byte {
+	return (*[KeccakBlockSize * 8]byte)(unsafe.Pointer(&s.state))
+}
+
+// Apply keccak-f[b] to the state, where b = 8 * s.size
+func (s *Strobe) permute() {
+	switch s.size {
+	case 1600 / 8:
+		a := &s.state
+		if !littleEndian {
+			swap64(a)
+		}
+		keccakF1600(a)
+		if !littleEndian {
+			swap64(a)
+		}
+	case 800 / 8:
+		a := (*[KeccakBlockSize]uint32)(unsafe.Pointer(&s.state))
+		if !littleEndian {
+			swap32(a)
+		}
+		keccakF800(a)
+		if !littleEndian {
+			swap32(a)
+		}
+	case 400 / 8:
+		a := (*[KeccakBlockSize]uint16)(unsafe.Pointer(&s.state))
+		if !littleEndian {
+			swap16(a)
+		}
+		keccakF400(a)
+		if !littleEndian {
+			swap16(a)
+		}
+	}
+}
+
+func swap64(a *[KeccakBlockSize]uint64) {
+	for i := range a {
+		a[i] = bits.ReverseBytes64(a[i])
+	}
+}
+
+func swap32(a *[KeccakBlockSize]uint32) {
+	for i := range a {
+		a[i] = bits.ReverseBytes32(a[i])
+	}
+}
+
+func swap16(a *[KeccakBlockSize]uint16) {
+	for i := range a {
+		a[i] = bits.ReverseBytes16(a[i])
+	}
+}
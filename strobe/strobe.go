@@ -2,7 +2,7 @@
 // Licensed under the MIT License.
 // See LICENSE.txt for details.
 
-// Partial implementation of Strobe protocol,
+// Implementation of Strobe protocol,
 //	invented by Mike Hamburg
 // Specs: https://strobe.sourceforge.io/specs/
 // References:
@@ -11,18 +11,29 @@
 //	Henry de Valence: 	https://github.com/hdevalence/libmerlin/blob/master/src/merlin.c
 //	dalek-cryptography: https://github.com/dalek-cryptography/merlin/blob/master/src/strobe.rs
 //
-// Probably it will be a full implementation someday
+// All operations from the specs are supported, except the keytree ones
 
 package strobe
 
-import "encoding/binary"
+import (
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"strconv"
+)
 
 // Default Strobe parameters
 const (
-	KeccakBlockSize = 25  // let b = KeccakBlockSize * 64, i.e. either 400, 800 or 1600 for keccak-f[b]
-	SecLevel        = 128 // a target security level, either 128 or 256 bits
-	rate            = 166 // 'R' parameter from spec = [b/8 - sec/4 - 2] is the number of bytes in a Strobe block
+	KeccakBlockSize = 25   // let b = KeccakBlockSize * w, where lane size w is 16, 32 or 64 bits for keccak-f[b]
+	KeccakWidth     = 1600 // default b, STROBE-lite uses either 400 or 800 bits
+	SecLevel        = 128  // a target security level, either 128 or 256 bits
 	StrobeVersion   = "1.0.2"
+	MinMacLength    = 16 // MACs shorter than 128 bits are refused by SendMac and RecvMac
+)
+
+var (
+	ErrAuthenticationFailed = errors.New("strobe: MAC verification failed")
+	ErrDestroyed            = errors.New("strobe: use of destroyed Strobe")
 )
 
 type flag uint8
@@ -31,45 +42,83 @@ const (
 	flagI flag = 1 << iota // inbound/outbound
 	flagA                  // application
 	flagC                  // cipher
-	flagT                  // transport [unsupported]
+	flagT                  // transport
 	flagM                  // meta
 	flagK                  // keytree [unsupported]
 )
 
-// Only `meta-AD`, `AD`, `KEY`, and `PRF` operations are supported
+// Only `AD`, `KEY`, `PRF`, `send_CLR`, `recv_CLR`, `send_ENC`, `recv_ENC`, `send_MAC`, `recv_MAC`,
+// `RATCHET` and meta variants of `AD` and `*_CLR` operations are supported
 const (
-	ad  = flagA
-	key = flagA | flagC
-	prf = flagI | flagA | flagC
-	//send_clr = flagA | flagT
-	//recv_clr = flagI | flagA | flagT
-	//send_enc = flagA | flagC | flagT
-	//recv_enc = flagI | flagA | flagC | flagT
-	//send_mac = flagC | flagT
-	//recv_mac = flagI | flagC | flagT
-	//ratchet  = flagC
-
-	metaAd = flagA | flagM
+	ad      = flagA
+	key     = flagA | flagC
+	prf     = flagI | flagA | flagC
+	sendClr = flagA | flagT
+	recvClr = flagI | flagA | flagT
+	sendEnc = flagA | flagC | flagT
+	recvEnc = flagI | flagA | flagC | flagT
+	sendMac = flagC | flagT
+	recvMac = flagI | flagC | flagT
+	ratchet = flagC
+
+	metaAd      = ad | flagM
+	metaSendClr = sendClr | flagM
+	metaRecvClr = recvClr | flagM
+)
+
+// Role of the party in transport operations, it is fixed
+// by the first operation with flagT: the sender becomes an initiator
+type role uint8
+
+const (
+	roleUndecided role = iota // no transport operations yet
+	roleInitiator
+	roleResponder
 )
 
 type Strobe struct {
 	flags    flag                    // current operation flags
-	bytes    []byte                  // bytes of state
-	state    [KeccakBlockSize]uint64 // internal keccak-f state
+	i0       role                    // 'I0' from spec
+	state    [KeccakBlockSize]uint64 // internal keccak-f state, see bytes() for the byte view
+	size     uint8                   // b/8 is the number of bytes in keccak-f[b] state
+	rate     uint8                   // 'R' parameter from spec = [b/8 - sec/4 - 2] is the number of bytes in a Strobe block
 	pos      uint8
 	posBegin uint8
 }
 
-func NewStrobe(label string) (s Strobe) {
-	s.bytes = make([]byte, KeccakBlockSize*8)
+func NewStrobe(label string) Strobe {
+	return NewStrobeWithSecurity(label, SecLevel)
+}
 
-	copy(s.bytes[:6], []byte{1, rate + 2, 1, 0, 1, 96})
-	copy(s.bytes[6:13], "STROBEv")
-	copy(s.bytes[13:], StrobeVersion)
+// Initialize Strobe with the target security level sec, either 128 or 256 bits
+func NewStrobeWithSecurity(label string, sec int) Strobe {
+	return NewStrobeWithParams(label, KeccakWidth, sec)
+}
 
-	bytesToState(&s.state, s.bytes)
-	keccakF1600(&s.state)
-	stateToBytes(s.state, s.bytes)
+// Initialize Strobe over keccak-f[b] with the target security level sec,
+// b = 400 or b = 800 give STROBE-lite variants for constrained devices.
+// Keccak-f[400] supports only 128 bits of security.
+// STROBE-lite isn't checked against the reference implementation yet,
+// so it isn't guaranteed to interoperate with it, see testdata/README.md
+func NewStrobeWithParams(label string, b int, sec int) (s Strobe) {
+	if b != 400 && b != 800 && b != 1600 {
+		panic("Keccak-f[" + strconv.Itoa(b) + "] is not supported, only 400, 800 or 1600")
+	}
+	if sec != 128 && sec != 256 {
+		panic("Security level " + strconv.Itoa(sec) + " is not supported, only 128 or 256 bits")
+	}
+	if b/8-sec/4-2 <= 0 {
+		panic("Security level " + strconv.Itoa(sec) + " is too high for keccak-f[" + strconv.Itoa(b) + "]")
+	}
+	s.size = uint8(b / 8)
+	s.rate = uint8(b/8 - sec/4 - 2)
+
+	bytes := s.bytes()
+	copy(bytes[:6], []byte{1, s.rate + 2, 1, 0, 1, 96})
+	copy(bytes[6:13], "STROBEv")
+	copy(bytes[13:], StrobeVersion)
+
+	s.permute()
 
 	s.MetaAd([]byte(label), false)
 	return
@@ -85,6 +134,76 @@ func (s *Strobe) MetaAd(data []byte, more bool) {
 	s.absorb(data)
 }
 
+// Send data in the clear, absorbing it into the state
+func (s *Strobe) SendClr(data []byte, more bool) {
+	s.beginOp(sendClr, more)
+	s.absorb(data)
+}
+
+// Receive data in the clear, absorbing it into the state
+func (s *Strobe) RecvClr(data []byte, more bool) {
+	s.beginOp(recvClr, more)
+	s.absorb(data)
+}
+
+func (s *Strobe) MetaSendClr(data []byte, more bool) {
+	s.beginOp(metaSendClr, more)
+	s.absorb(data)
+}
+
+func (s *Strobe) MetaRecvClr(data []byte, more bool) {
+	s.beginOp(metaRecvClr, more)
+	s.absorb(data)
+}
+
+// Encrypt data in place, the ciphertext becomes a part of the state
+func (s *Strobe) SendEnc(data []byte, more bool) {
+	s.beginOp(sendEnc, more)
+	s.encrypt(data)
+}
+
+// Decrypt data in place, the ciphertext becomes a part of the state
+func (s *Strobe) RecvEnc(data []byte, more bool) {
+	s.beginOp(recvEnc, more)
+	s.decrypt(data)
+}
+
+// Compute a MAC of len(dst) bytes over the whole transcript into dst.
+// Panics if len(dst) < MinMacLength.
+func (s *Strobe) SendMac(dst []byte) {
+	if len(dst) < MinMacLength {
+		panic("MAC length is less than min allowed (MinMacLength)")
+	}
+	s.beginOp(sendMac, false)
+	s.copyState(dst)
+}
+
+// Verify the received MAC in constant time.
+// Returns ErrAuthenticationFailed if tag is invalid or shorter than MinMacLength
+// and ErrDestroyed if s is destroyed.
+func (s *Strobe) RecvMac(tag []byte) error {
+	if s.Destroyed() {
+		return ErrDestroyed
+	}
+	if len(tag) < MinMacLength {
+		return ErrAuthenticationFailed
+	}
+	s.beginOp(recvMac, false)
+
+	diff := make([]byte, len(tag))
+	copy(diff, tag)
+	s.decrypt(diff)
+
+	var acc byte
+	for _, b := range diff {
+		acc |= b
+	}
+	if subtle.ConstantTimeByteEq(acc, 0) != 1 {
+		return ErrAuthenticationFailed
+	}
+	return nil
+}
+
 func (s *Strobe) Prf(data []byte, more bool) {
 	s.beginOp(prf, more)
 	s.squeeze(data)
@@ -95,73 +214,165 @@ func (s *Strobe) Key(data []byte, more bool) {
 	s.overwrite(data)
 }
 
-func (s *Strobe) Clone() (clone Strobe) {
-	clone = *s
-	clone.bytes = make([]byte, len(s.bytes))
-	copy(clone.bytes, s.bytes)
-	return
+// Zero out length bytes of the state to prevent rollback,
+// a length of SecLevel/8 bytes is enough
+func (s *Strobe) Ratchet(length int, more bool) {
+	s.beginOp(ratchet, more)
+	s.zero(length)
 }
 
-func stateToBytes(state [25]uint64, bytes []byte) {
-	for i := 0; len(bytes) >= 8; i++ {
-		binary.LittleEndian.PutUint64(bytes, state[i])
-		bytes = bytes[8:]
-	}
+func (s *Strobe) Clone() Strobe {
+	return *s
 }
 
-func bytesToState(state *[25]uint64, bytes []byte) {
-	for i := range state {
-		state[i] = binary.LittleEndian.Uint64(bytes)
-		bytes = bytes[8:]
+// Wipe the whole keccak-f state and the Strobe parameters,
+// any later operation panics with ErrDestroyed.
+// Copies made before, e.g. by Clone, are not affected
+func (s *Strobe) Destroy() {
+	for i := range s.state {
+		s.state[i] = 0
 	}
+	*s = Strobe{}
 }
 
+// Report whether s was destroyed or never initialized
+func (s *Strobe) Destroyed() bool {
+	return s.size == 0
+}
+
+// The duplex functions below process data in spans up to the end of
+// the current block, each span is handled 8 bytes at a time, see xorInto
+
 func (s *Strobe) absorb(data []byte) {
-	for i := range data {
-		s.bytes[s.pos] ^= data[i]
-		s.pos += 1
-		if s.pos == rate {
-			s.runF()
-		}
+	for len(data) > 0 {
+		block := s.span(len(data))
+		xorInto(block, data)
+		data = data[len(block):]
+		s.advance(len(block))
 	}
 }
 
 func (s *Strobe) squeeze(data []byte) {
-	for i := range data {
-		data[i] = s.bytes[s.pos]
-		s.bytes[s.pos] = 0
-		s.pos += 1
-		if s.pos == rate {
-			s.runF()
+	for len(data) > 0 {
+		block := s.span(len(data))
+		copy(data, block)
+		for i := range block {
+			block[i] = 0
 		}
+		data = data[len(block):]
+		s.advance(len(block))
 	}
 }
 
 func (s *Strobe) overwrite(data []byte) {
-	for i := range data {
-		s.bytes[s.pos] = data[i]
-		s.pos += 1
-		if s.pos == rate {
-			s.runF()
+	for len(data) > 0 {
+		block := s.span(len(data))
+		copy(block, data)
+		data = data[len(block):]
+		s.advance(len(block))
+	}
+}
+
+func (s *Strobe) zero(length int) {
+	for length > 0 {
+		block := s.span(length)
+		for i := range block {
+			block[i] = 0
 		}
+		length -= len(block)
+		s.advance(len(block))
+	}
+}
+
+func (s *Strobe) copyState(data []byte) {
+	for len(data) > 0 {
+		block := s.span(len(data))
+		copy(data, block)
+		data = data[len(block):]
+		s.advance(len(block))
+	}
+}
+
+func (s *Strobe) encrypt(data []byte) {
+	for len(data) > 0 {
+		block := s.span(len(data))
+		xorInto(block, data)
+		copy(data, block)
+		data = data[len(block):]
+		s.advance(len(block))
+	}
+}
+
+func (s *Strobe) decrypt(data []byte) {
+	for len(data) > 0 {
+		block := s.span(len(data))
+		exchange(block, data)
+		data = data[len(block):]
+		s.advance(len(block))
+	}
+}
+
+// Unprocessed part of the current block, but no more than n bytes
+func (s *Strobe) span(n int) []byte {
+	block := s.bytes()[s.pos:s.rate]
+	if n < len(block) {
+		block = block[:n]
+	}
+	return block
+}
+
+// Move the position by n bytes processed within the current block
+func (s *Strobe) advance(n int) {
+	s.pos += uint8(n)
+	if s.pos == s.rate {
+		s.runF()
+	}
+}
+
+// dst[i] ^= src[i] for every byte of dst
+func xorInto(dst, src []byte) {
+	src = src[:len(dst)]
+	for len(dst) >= 8 {
+		w := binary.LittleEndian.Uint64(dst) ^ binary.LittleEndian.Uint64(src)
+		binary.LittleEndian.PutUint64(dst, w)
+		dst, src = dst[8:], src[8:]
+	}
+	for i := range dst {
+		dst[i] ^= src[i]
+	}
+}
+
+// state[i], data[i] = data[i], state[i] ^ data[i] for every byte of state
+func exchange(state, data []byte) {
+	data = data[:len(state)]
+	for len(state) >= 8 {
+		c := binary.LittleEndian.Uint64(data)
+		binary.LittleEndian.PutUint64(data, c^binary.LittleEndian.Uint64(state))
+		binary.LittleEndian.PutUint64(state, c)
+		state, data = state[8:], data[8:]
+	}
+	for i := range state {
+		state[i], data[i] = data[i], state[i]^data[i]
 	}
 }
 
 // Sponge function F
 func (s *Strobe) runF() {
-	s.bytes[s.pos] ^= s.posBegin
-	s.bytes[s.pos+1] ^= 0x04
-	s.bytes[rate+1] ^= 0x80
+	bytes := s.bytes()
+	bytes[s.pos] ^= s.posBegin
+	bytes[s.pos+1] ^= 0x04
+	bytes[s.rate+1] ^= 0x80
 
-	bytesToState(&s.state, s.bytes)
-	keccakF1600(&s.state)
-	stateToBytes(s.state, s.bytes) // this should be more elegant
+	s.permute()
 
 	s.pos = 0
 	s.posBegin = 0
 }
 
 func (s *Strobe) beginOp(flags flag, more bool) {
+	if s.Destroyed() {
+		panic(ErrDestroyed)
+	}
 	if more {
 		if flags != s.flags {
 			panic("Trying to continue operation with different flags")
@@ -170,9 +381,22 @@ func (s *Strobe) beginOp(flags flag, more bool) {
 		return
 	}
 
+	s.flags = flags
+	if flags&flagT != 0 {
+		if s.i0 == roleUndecided {
+			s.i0 = roleInitiator
+			if flags&flagI != 0 {
+				s.i0 = roleResponder
+			}
+		}
+		// responder flips the direction so both parties absorb the same flags
+		if s.i0 == roleResponder {
+			flags ^= flagI
+		}
+	}
+
 	oldBegin := s.posBegin
 	s.posBegin = s.pos + 1
-	s.flags = flags
 	s.absorb([]byte{oldBegin, byte(flags)})
 
 	forceF := (flags & flagC) != 0
@@ -10,56 +10,104 @@ import (
 	"github.com/stretchr/testify/assert"
 	"reflect"
 	"testing"
-	"time"
 )
 
-func elapse(t *testing.T, description string, action func()) {
-	total := time.Duration(0)
-
-	for i := 0; i < rounds; i++ {
-		start := time.Now()
-		action()
-		total += time.Since(start)
-	}
-
-	elapsed := time.Duration(total.Nanoseconds() / rounds)
-	t.Logf("%s elapsed in %v", description, elapsed)
-}
-
 func getState(s strobe.Strobe) reflect.Value {
 	v := reflect.ValueOf(s)
 	return v.FieldByName("a")
 }
 
+// StrobeGo keeps absorbed bytes aside until the next permutation,
+// so states are compared by squeezing more than a block out of clones
 func assertStrobes(t *testing.T, s1 Strobe, s2 strobe.Strobe) {
-	state := getState(s2)
-	for i := 0; i < state.Len(); i++ {
-		elem := state.Index(i).Uint()
-		assert.Equal(t, s1.state[i], elem, "states aren't the same")
-	}
+	prf1 := make([]byte, 2*s1.rate)
+	c1 := s1.Clone()
+	c1.Prf(prf1, false)
+	prf2 := s2.Clone().PRF(len(prf1))
+	assert.Equal(t, prf1, prf2, "states aren't the same")
 }
 
-const rounds = 1000
-
 func TestInit(t *testing.T) {
 	s1 := NewStrobe(t.Name())
 	s2 := strobe.InitStrobe(t.Name(), SecLevel)
 
 	assertStrobes(t, s1, s2)
 
-	elapse(t, t.Name()+"Mini", func() {
-		NewStrobe(t.Name())
-	})
-
-	elapse(t, t.Name()+"Mimo", func() {
-		strobe.InitStrobe(t.Name(), SecLevel)
-	})
-
 	t.Logf("position: %d", s1.pos)
 	t.Logf("%+v", s1.state)
 	t.Logf("%+v", getState(s2))
 }
 
+func TestSecurityLevel(t *testing.T) {
+	data := []byte(" very long data to force F: AAAAAAOOOOOOOOOAAAOAOAOAOAOAO, mmmmmmmmmmmmmmmmm")
+
+	s1 := NewStrobeWithSecurity(t.Name(), 256)
+	s2 := strobe.InitStrobe(t.Name(), 256)
+	prf1, prf2 := make([]byte, 32), make([]byte, 32)
+
+	assert.Equal(t, uint8(134), s1.rate)
+	assertStrobes(t, s1, s2)
+
+	s1.Ad(data, false)
+	s1.Ad(data, true)
+	s1.Prf(prf1, false)
+
+	s2.AD(false, data)
+	s2.Operate(false, "AD", data, 0, true)
+	prf2 = s2.PRF(len(prf2))
+
+	assertStrobes(t, s1, s2)
+	assert.Equal(t, prf1, prf2, "prf returned bytes aren't the same")
+
+	assert.Equal(t, uint8(166), NewStrobeWithSecurity(t.Name(), 128).rate)
+	assert.Panics(t, func() {
+		NewStrobeWithSecurity(t.Name(), 192)
+	})
+}
+
+func TestStrobeLite(t *testing.T) {
+	key := []byte("shared secret key")
+	message := []byte(" very long data to force F: AAAAAAOOOOOOOOOAAAOAOAOAOAOAO, mmmmmmmmmmmmmmmmm")
+
+	for _, params := range []struct{ b, sec, rate int }{
+		{400, 128, 16},
+		{800, 128, 66},
+		{800, 256, 34},
+	} {
+		alice := NewStrobeWithParams(t.Name(), params.b, params.sec)
+		bob := NewStrobeWithParams(t.Name(), params.b, params.sec)
+		assert.Equal(t, uint8(params.b/8), alice.size)
+		assert.Equal(t, uint8(params.rate), alice.rate)
+
+		alice.Key(key, false)
+		bob.Key(key, false)
+
+		wire := append([]byte{}, message...)
+		tag := make([]byte, MinMacLength)
+		alice.SendEnc(wire, false)
+		alice.SendMac(tag)
+		bob.RecvEnc(wire, false)
+		assert.NoError(t, bob.RecvMac(tag))
+		assert.Equal(t, message, wire)
+
+		prf1, prf2, prf3 := make([]byte, 32), make([]byte, 32), make([]byte, 32)
+		alice.Prf(prf1, false)
+		bob.Prf(prf2, false)
+		s := NewStrobe(t.Name())
+		s.Key(key, false)
+		s.Prf(prf3, false)
+		assert.Equal(t, prf1, prf2, "prf returned bytes aren't the same")
+		assert.NotEqual(t, prf1, prf3, "lite prf matches keccak-f[1600] one")
+	}
+
+	assert.Panics(t, func() {
+		NewStrobeWithParams(t.Name(), 400, 256)
+	})
+	assert.Panics(t, func() {
+		NewStrobeWithParams(t.Name(), 200, 128)
+	})
+}
+
 func TestAd(t *testing.T) {
 	data := []byte(" very long data to force F: AAAAAAOOOOOOOOOAAAOAOAOAOAOAO, mmmmmmmmmmmmmmmmm")
 
@@ -76,20 +124,6 @@ func TestAd(t *testing.T) {
 
 	assertStrobes(t, s1, s2)
 
-	elapse(t, t.Name()+"Mini", func() {
-		s := NewStrobe(t.Name())
-		s.Ad([]byte(t.Name()), false)
-		s.Ad(data, true)
-		s.Ad(data, true)
-	})
-
-	elapse(t, t.Name()+"Mimo", func() {
-		s := strobe.InitStrobe(t.Name(), SecLevel)
-		s.AD(false, []byte(t.Name()))
-		s.Operate(false, "AD", data, 0, true)
-		s.Operate(false, "AD", data, 0, true)
-	})
-
 	t.Logf("position: %d", s1.pos)
 	t.Logf("%+v", s1.state)
 	t.Logf("%+v", getState(s2))
@@ -109,18 +143,6 @@ func TestPrf(t *testing.T) {
 	assertStrobes(t, s1, s2)
 	assert.Equal(t, prf1, prf2, "prf returned bytes aren't the same")
 
-	elapse(t, t.Name()+"Mini", func() {
-		s := NewStrobe(t.Name())
-		s.Ad([]byte(t.Name()), false)
-		s.Prf(prf1[:], false)
-	})
-
-	elapse(t, t.Name()+"Mimo", func() {
-		s := strobe.InitStrobe(t.Name(), SecLevel)
-		s.AD(false, []byte(t.Name()))
-		prf2 = s.PRF(len(prf2))
-	})
-
 	t.Logf("position: %d", s1.pos)
 	t.Logf("s1 state: %v", s1.state)
 	t.Logf("s2 state: %v", getState(s2))
@@ -145,27 +167,300 @@ func TestKey(t *testing.T) {
 	s2.AD(false, data)
 	s2.Operate(false, "AD", data, 0, true)
 
-	elapse(t, t.Name()+"Mini", func() {
-		s := NewStrobe(t.Name())
-		s.Ad([]byte(t.Name()), false)
-		s.Key(key, false)
-		s.Ad(data, false)
-		s.Ad(data, true)
-	})
-
-	elapse(t, t.Name()+"Mimo", func() {
-		s := strobe.InitStrobe(t.Name(), SecLevel)
-		s.AD(false, []byte(t.Name()))
-		s.KEY(key)
-		s.AD(false, data)
-		s.Operate(false, "AD", data, 0, true)
-	})
+	assertStrobes(t, s1, s2)
 
 	t.Logf("position: %d", s1.pos)
 	t.Logf("%+v", s1.state)
 	t.Logf("%+v", getState(s2))
 }
 
+func TestSendClr(t *testing.T) {
+	header := []byte("framing header")
+	data := []byte(" very long data to force F: AAAAAAOOOOOOOOOAAAOAOAOAOAOAO, mmmmmmmmmmmmmmmmm")
+
+	s1 := NewStrobe(t.Name())
+	s2 := strobe.InitStrobe(t.Name(), SecLevel)
+	prf1, prf2 := make([]byte, 32), make([]byte, 32)
+
+	s1.MetaSendClr(header, false)
+	s1.SendClr(data, false)
+	s1.SendClr(data, true)
+	s1.Prf(prf1, false)
+
+	s2.Send_CLR(true, header)
+	s2.Send_CLR(false, data)
+	s2.Operate(false, "send_CLR", data, 0, true)
+	prf2 = s2.PRF(len(prf2))
+
+	assertStrobes(t, s1, s2)
+	assert.Equal(t, prf1, prf2, "prf returned bytes aren't the same")
+}
+
+func TestRecvClr(t *testing.T) {
+	header := []byte("framing header")
+	data := []byte(" very long data to force F: AAAAAAOOOOOOOOOAAAOAOAOAOAOAO, mmmmmmmmmmmmmmmmm")
+
+	s1 := NewStrobe(t.Name())
+	s2 := strobe.InitStrobe(t.Name(), SecLevel)
+	prf1, prf2 := make([]byte, 32), make([]byte, 32)
+
+	s1.SendClr(header, false)
+	s1.MetaRecvClr(header, false)
+	s1.RecvClr(data, false)
+	s1.RecvClr(data, true)
+	s1.Prf(prf1, false)
+
+	s2.Send_CLR(false, header)
+	s2.Recv_CLR(true, header)
+	s2.Recv_CLR(false, data)
+	s2.Operate(false, "recv_CLR", data, 0, true)
+	prf2 = s2.PRF(len(prf2))
+
+	assertStrobes(t, s1, s2)
+	assert.Equal(t, prf1, prf2, "prf returned bytes aren't the same")
+}
+
+func TestSendEnc(t *testing.T) {
+	key := []byte("secret key")
+	plaintext := []byte(" very long data to force F: AAAAAAOOOOOOOOOAAAOAOAOAOAOAO, mmmmmmmmmmmmmmmmm")
+
+	s1 := NewStrobe(t.Name())
+	s2 := strobe.InitStrobe(t.Name(), SecLevel)
+	prf1, prf2 := make([]byte, 32), make([]byte, 32)
+
+	ciphertext := append([]byte{}, plaintext...)
+	s1.Key(key, false)
+	s1.SendEnc(ciphertext[:32], false)
+	s1.SendEnc(ciphertext[32:], true)
+	s1.Prf(prf1, false)
+
+	s2.KEY(key)
+	expected := s2.Send_ENC_unauthenticated(false, plaintext)
+	prf2 = s2.PRF(len(prf2))
+
+	assertStrobes(t, s1, s2)
+	assert.Equal(t, expected, ciphertext, "ciphertexts aren't the same")
+	assert.NotEqual(t, plaintext, ciphertext)
+	assert.Equal(t, prf1, prf2, "prf returned bytes aren't the same")
+}
+
+func TestRecvEnc(t *testing.T) {
+	key := []byte("secret key")
+	ciphertext := []byte(" very long data to force F: AAAAAAOOOOOOOOOAAAOAOAOAOAOAO, mmmmmmmmmmmmmmmmm")
+
+	s1 := NewStrobe(t.Name())
+	s2 := strobe.InitStrobe(t.Name(), SecLevel)
+	prf1, prf2 := make([]byte, 32), make([]byte, 32)
+
+	plaintext := append([]byte{}, ciphertext...)
+	s1.Key(key, false)
+	s1.SendClr([]byte("hello"), false)
+	s1.RecvEnc(plaintext[:32], false)
+	s1.RecvEnc(plaintext[32:], true)
+	s1.Prf(prf1, false)
+
+	s2.KEY(key)
+	s2.Send_CLR(false, []byte("hello"))
+	expected := s2.Recv_ENC_unauthenticated(false, ciphertext)
+	prf2 = s2.PRF(len(prf2))
+
+	assertStrobes(t, s1, s2)
+	assert.Equal(t, expected, plaintext, "plaintexts aren't the same")
+	assert.Equal(t, prf1, prf2, "prf returned bytes aren't the same")
+}
+
+func TestSendMac(t *testing.T) {
+	key := []byte("secret key")
+	data := []byte(" very long data to force F: AAAAAAOOOOOOOOOAAAOAOAOAOAOAO, mmmmmmmmmmmmmmmmm")
+
+	s1 := NewStrobe(t.Name())
+	s2 := strobe.InitStrobe(t.Name(), SecLevel)
+	mac1, prf1, prf2 := make([]byte, 32), make([]byte, 32), make([]byte, 32)
+
+	s1.Key(key, false)
+	s1.SendClr(data, false)
+	s1.SendMac(mac1)
+	s1.Prf(prf1, false)
+
+	s2.KEY(key)
+	s2.Send_CLR(false, data)
+	mac2 := s2.Send_MAC(false, len(mac1))
+	prf2 = s2.PRF(len(prf2))
+
+	assertStrobes(t, s1, s2)
+	assert.Equal(t, mac1, mac2, "macs aren't the same")
+	assert.Equal(t, prf1, prf2, "prf returned bytes aren't the same")
+
+	assert.Panics(t, func() {
+		s1.SendMac(make([]byte, MinMacLength-1))
+	})
+}
+
+func TestRecvMac(t *testing.T) {
+	key := []byte("secret key")
+	data := []byte(" very long data to force F: AAAAAAOOOOOOOOOAAAOAOAOAOAOAO, mmmmmmmmmmmmmmmmm")
+
+	s1 := NewStrobe(t.Name())
+	s2 := strobe.InitStrobe(t.Name(), SecLevel)
+	prf1, prf2 := make([]byte, 32), make([]byte, 32)
+
+	s1.Key(key, false)
+	s1.SendClr(data, false)
+
+	s2.KEY(key)
+	s2.Send_CLR(false, data)
+
+	// the only valid tag is the state right after recv_MAC has begun
+	tag := make([]byte, MinMacLength)
+	s3 := s1.Clone()
+	s3.beginOp(recvMac, false)
+	s3.copyState(tag)
+
+	forged := append([]byte{}, tag...)
+	forged[len(forged)-1] ^= 1
+	s4 := s1.Clone()
+	assert.Equal(t, ErrAuthenticationFailed, s4.RecvMac(forged))
+	assert.Equal(t, ErrAuthenticationFailed, s4.RecvMac(tag[:MinMacLength-1]))
+
+	assert.NoError(t, s1.RecvMac(tag))
+	s1.Prf(prf1, false)
+
+	assert.True(t, s2.Recv_MAC(false, tag))
+	prf2 = s2.PRF(len(prf2))
+
+	assertStrobes(t, s1, s2)
+	assert.Equal(t, prf1, prf2, "prf returned bytes aren't the same")
+}
+
+func TestRatchet(t *testing.T) {
+	key := []byte("secret key")
+
+	s1 := NewStrobe(t.Name())
+	s2 := strobe.InitStrobe(t.Name(), SecLevel)
+	prf1, prf2 := make([]byte, 32), make([]byte, 32)
+
+	s1.Key(key, false)
+	s1.Ratchet(SecLevel/8, false)
+	s1.Ratchet(int(s1.rate), true)
+	s1.Prf(prf1, false)
+
+	s2.KEY(key)
+	s2.RATCHET(SecLevel/8 + int(s1.rate))
+	prf2 = s2.PRF(len(prf2))
+
+	assertStrobes(t, s1, s2)
+	assert.Equal(t, prf1, prf2, "prf returned bytes aren't the same")
+}
+
+func TestResponder(t *testing.T) {
+	key := []byte("secret key")
+	data := []byte(" very long data to force F: AAAAAAOOOOOOOOOAAAOAOAOAOAOAO, mmmmmmmmmmmmmmmmm")
+
+	s1 := NewStrobe(t.Name())
+	s2 := strobe.InitStrobe(t.Name(), SecLevel)
+	mac, prf1, prf2 := make([]byte, 32), make([]byte, 32), make([]byte, 32)
+
+	plaintext := append([]byte{}, data...)
+	s1.Key(key, false)
+	s1.RecvClr(data, false)
+	s1.RecvEnc(plaintext, false)
+	s1.SendClr(data, false)
+	s1.SendMac(mac)
+	s1.Prf(prf1, false)
+
+	s2.KEY(key)
+	s2.Recv_CLR(false, data)
+	expected := s2.Recv_ENC_unauthenticated(false, data)
+	s2.Send_CLR(false, data)
+	expectedMac := s2.Send_MAC(false, len(mac))
+	prf2 = s2.PRF(len(prf2))
+
+	assertStrobes(t, s1, s2)
+	assert.Equal(t, roleResponder, s1.i0)
+	assert.Equal(t, expected, plaintext, "plaintexts aren't the same")
+	assert.Equal(t, expectedMac, mac, "macs aren't the same")
+	assert.Equal(t, prf1, prf2, "prf returned bytes aren't the same")
+}
+
+func TestTwoParties(t *testing.T) {
+	key := []byte("shared secret key")
+	hello := []byte("hello, this is alice")
+	message := []byte(" very long data to force F: AAAAAAOOOOOOOOOAAAOAOAOAOAOAO, mmmmmmmmmmmmmmmmm")
+
+	alice := NewStrobe(t.Name())
+	bob := NewStrobe(t.Name())
+	alice.Key(key, false)
+	bob.Key(key, false)
+
+	// alice -> bob: cleartext greeting
+	alice.SendClr(hello, false)
+	bob.RecvClr(hello, false)
+	assert.Equal(t, roleInitiator, alice.i0)
+	assert.Equal(t, roleResponder, bob.i0)
+	assert.Equal(t, alice.state, bob.state)
+
+	// bob -> alice: encrypted and authenticated message
+	wire := append([]byte{}, message...)
+	tag := make([]byte, MinMacLength)
+	bob.SendEnc(wire, false)
+	bob.SendMac(tag)
+	assert.NotEqual(t, message, wire)
+
+	alice.RecvEnc(wire, false)
+	assert.NoError(t, alice.RecvMac(tag))
+	assert.Equal(t, message, wire)
+	assert.Equal(t, alice.state, bob.state)
+
+	// alice -> bob: tampered ciphertext is rejected
+	wire = append(wire[:0], message...)
+	alice.SendEnc(wire, false)
+	alice.SendMac(tag)
+	wire[0] ^= 1
+	bob.RecvEnc(wire, false)
+	assert.Equal(t, ErrAuthenticationFailed, bob.RecvMac(tag))
+
+	// roles don't change after the first transport operation
+	assert.Equal(t, roleInitiator, alice.i0)
+	assert.Equal(t, roleResponder, bob.i0)
+}
+
+func TestUnalignedSpans(t *testing.T) {
+	data := make([]byte, 2*166+9)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	s1 := NewStrobe(t.Name())
+	s2 := strobe.InitStrobe(t.Name(), SecLevel)
+
+	// lengths around word and block boundaries at shifting positions,
+	// StrobeGo refuses zero lengths for PRF and RATCHET, so 0 isn't compared
+	for _, length := range []int{1, 7, 8, 9, 15, 16, 17, 165, 166, 167, len(data)} {
+		s1.Ad(data[:length], false)
+		s2.AD(false, data[:length])
+
+		s1.Key(data[:length], false)
+		s2.KEY(data[:length])
+
+		prf := make([]byte, length)
+		s1.Prf(prf, false)
+		assert.Equal(t, s2.PRF(length), prf, "prf returned bytes aren't the same")
+
+		enc := append([]byte{}, data[:length]...)
+		s1.SendEnc(enc, false)
+		assert.Equal(t, s2.Send_ENC_unauthenticated(false, data[:length]), enc, "ciphertexts aren't the same")
+
+		dec := append([]byte{}, data[:length]...)
+		s1.RecvEnc(dec, false)
+		assert.Equal(t, s2.Recv_ENC_unauthenticated(false, data[:length]), dec, "plaintexts aren't the same")
+
+		s1.Ratchet(length, false)
+		s2.RATCHET(length)
+
+		assertStrobes(t, s1, s2)
+	}
+}
+
 func TestClone(t *testing.T) {
 	s1 := NewStrobe(t.Name())
 	s1.Ad([]byte("we gonna clone "), false)
@@ -184,3 +479,122 @@ func TestClone(t *testing.T) {
 	t.Logf("hash2: %s", hex.EncodeToString(hash2))
 	assert.Equal(t, hash1, hash2)
 }
+
+func TestDestroy(t *testing.T) {
+	s1 := NewStrobe(t.Name())
+	s1.Key([]byte("secret key"), false)
+	s2 := s1.Clone()
+
+	s1.Destroy()
+	assert.True(t, s1.Destroyed())
+	assert.Equal(t, Strobe{}, s1)
+	assert.False(t, s2.Destroyed(), "clone mustn't be wiped")
+
+	assert.PanicsWithValue(t, ErrDestroyed, func() { s1.Ad([]byte("data"), false) })
+	assert.PanicsWithValue(t, ErrDestroyed, func() { s1.Prf(make([]byte, 16), false) })
+	assert.PanicsWithValue(t, ErrDestroyed, func() { s1.Ratchet(16, false) })
+	assert.ErrorIs(t, s1.RecvMac(make([]byte, MinMacLength)), ErrDestroyed)
+	_, err := s1.MarshalBinary()
+	assert.ErrorIs(t, err, ErrDestroyed)
+}
+
+func BenchmarkNewStrobe(b *testing.B) {
+	b.Run("Mini", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			NewStrobe(b.Name())
+		}
+	})
+	b.Run("Mimo", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			strobe.InitStrobe(b.Name(), SecLevel)
+		}
+	})
+}
+
+var benchmarkSizes = []struct {
+	name string
+	size int
+}{
+	{"32B", 32},
+	{"1KiB", 1 << 10},
+	{"1MiB", 1 << 20},
+}
+
+func BenchmarkAd(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		data := make([]byte, size.size)
+
+		b.Run("Mini/"+size.name, func(b *testing.B) {
+			b.ReportAllocs()
+			s := NewStrobe(b.Name())
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				s.Ad(data, false)
+			}
+		})
+		b.Run("Mimo/"+size.name, func(b *testing.B) {
+			b.ReportAllocs()
+			s := strobe.InitStrobe(b.Name(), SecLevel)
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				s.AD(false, data)
+			}
+		})
+	}
+}
+
+func BenchmarkPrf(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		data := make([]byte, size.size)
+
+		b.Run("Mini/"+size.name, func(b *testing.B) {
+			b.ReportAllocs()
+			s := NewStrobe(b.Name())
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				s.Prf(data, false)
+			}
+		})
+		b.Run("Mimo/"+size.name, func(b *testing.B) {
+			b.ReportAllocs()
+			s := strobe.InitStrobe(b.Name(), SecLevel)
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				s.PRF(len(data))
+			}
+		})
+	}
+}
+
+func BenchmarkKey(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		data := make([]byte, size.size)
+
+		b.Run("Mini/"+size.name, func(b *testing.B) {
+			b.ReportAllocs()
+			s := NewStrobe(b.Name())
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				s.Key(data, false)
+			}
+		})
+		b.Run("Mimo/"+size.name, func(b *testing.B) {
+			b.ReportAllocs()
+			s := strobe.InitStrobe(b.Name(), SecLevel)
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				s.KEY(data)
+			}
+		})
+	}
+}
+
+func BenchmarkRunF(b *testing.B) {
+	b.ReportAllocs()
+	s := NewStrobe(b.Name())
+	for i := 0; i < b.N; i++ {
+		s.runF()
+	}
+}
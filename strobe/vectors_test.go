@@ -0,0 +1,172 @@
+// Copyright © 2019. Sergey Skaredov.
+// Licensed under the MIT License.
+// See LICENSE.txt for details.
+
+package strobe
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Known-answer vectors in the format of StrobeGo test_vectors.json,
+// see testdata/README.md. Every operation is checked against the whole
+// keccak-f state after it. Width is an extension of the format for
+// STROBE-lite vectors, keccak-f[1600] is assumed if it's missing
+type strobeVectors struct {
+	Width       int            `json:"width"`
+	TestVectors []strobeVector `json:"test_vectors"`
+}
+
+type strobeVector struct {
+	Name       string           `json:"name"`
+	Operations []strobeVectorOp `json:"operations"`
+}
+
+type strobeVectorOp struct {
+	Name         string `json:"name"`
+	CustomString string `json:"custom_string"`
+	Security     int    `json:"security"`
+	Meta         bool   `json:"meta"`
+	Stream       bool   `json:"stream"`
+	InputData    string `json:"input_data"`
+	InputLength  int    `json:"input_length"`
+	Output       string `json:"output"`
+	StateAfter   string `json:"state_after"`
+}
+
+var vectorFlags = map[string]flag{
+	"AD":       ad,
+	"KEY":      key,
+	"PRF":      prf,
+	"send_CLR": sendClr,
+	"recv_CLR": recvClr,
+	"send_ENC": sendEnc,
+	"recv_ENC": recvEnc,
+	"send_MAC": sendMac,
+	"recv_MAC": recvMac,
+	"RATCHET":  ratchet,
+}
+
+// Run the operation on the duplex level, so that meta variants and short
+// MACs, which aren't available through the API, are covered too
+func runVectorOp(t *testing.T, s *Strobe, op *strobeVectorOp) []byte {
+	flags, ok := vectorFlags[op.Name]
+	if !ok {
+		t.Fatalf("unknown operation %q", op.Name)
+	}
+	if op.Meta {
+		flags |= flagM
+	}
+	data, err := hex.DecodeString(op.InputData)
+	if err != nil {
+		t.Fatalf("invalid input data %q: %v", op.InputData, err)
+	}
+
+	s.beginOp(flags, op.Stream)
+	switch op.Name {
+	case "AD", "send_CLR", "recv_CLR":
+		s.absorb(data)
+		return data
+	case "KEY":
+		s.overwrite(data)
+		return nil
+	case "PRF":
+		out := make([]byte, op.InputLength)
+		s.squeeze(out)
+		return out
+	case "send_MAC":
+		out := make([]byte, op.InputLength)
+		s.copyState(out)
+		return out
+	case "RATCHET":
+		s.zero(op.InputLength)
+		return nil
+	case "send_ENC":
+		s.encrypt(data)
+		return data
+	case "recv_ENC":
+		s.decrypt(data)
+		return data
+	case "recv_MAC":
+		// StrobeGo reports the result as 0 if the MAC is valid and 0xff otherwise
+		s.decrypt(data)
+		var acc byte
+		for _, b := range data {
+			acc |= b
+		}
+		if acc != 0 {
+			return []byte{0xff}
+		}
+		return []byte{0}
+	}
+	return nil
+}
+
+func runStrobeVectors(t *testing.T, file string) (widths map[int]int) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var vectors strobeVectors
+	if err := json.Unmarshal(data, &vectors); err != nil {
+		t.Fatalf("%s: %v", file, err)
+	}
+	width := vectors.Width
+	if width == 0 {
+		width = KeccakWidth
+	}
+
+	widths = map[int]int{}
+	for _, v := range vectors.TestVectors {
+		v := v
+		widths[width]++
+		t.Run(filepath.Base(file)+"/"+v.Name, func(t *testing.T) {
+			var s Strobe
+			for i := range v.Operations {
+				op := &v.Operations[i]
+				var out []byte
+				if op.Name == "init" {
+					s = NewStrobeWithParams(op.CustomString, width, op.Security)
+				} else {
+					out = runVectorOp(t, &s, op)
+				}
+				if op.Output != "" {
+					assert.Equal(t, op.Output, hex.EncodeToString(out), "output of operation %d %s", i, op.Name)
+				}
+				assert.Equal(t, op.StateAfter, hex.EncodeToString(s.bytes()[:s.size]), "state after operation %d %s", i, op.Name)
+			}
+		})
+	}
+	return widths
+}
+
+func TestStrobeVectors(t *testing.T) {
+	widths := runStrobeVectors(t, filepath.Join("testdata", "strobe_vectors.json"))
+	assert.NotZero(t, widths[KeccakWidth])
+}
+
+// STROBE-lite known answers are generated with the reference implementation,
+// see testdata/README.md. Until they are vendored the widths are skipped,
+// not passed, and STROBE-lite isn't claimed to be interoperable
+func TestStrobeLiteVectors(t *testing.T) {
+	for _, w := range []int{800, 400} {
+		w := w
+		t.Run(fmt.Sprintf("keccak-f[%d]", w), func(t *testing.T) {
+			file := filepath.Join("testdata", fmt.Sprintf("strobe_lite_%d_vectors.json", w))
+			if _, err := os.Stat(file); errors.Is(err, fs.ErrNotExist) {
+				t.Skipf("%s isn't vendored yet", file)
+			}
+			widths := runStrobeVectors(t, file)
+			assert.NotZero(t, widths[w], "%s has no keccak-f[%d] vectors", file, w)
+			assert.Len(t, widths, 1, "%s has vectors of other widths", file)
+		})
+	}
+}
@@ -0,0 +1,297 @@
+// Copyright © 2019. Sergey Skaredov.
+// Licensed under the MIT License.
+// See LICENSE.txt for details.
+
+package merlin
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	. "github.com/skoret/merlin/strobe"
+	"math/big"
+	"reflect"
+	"sync"
+)
+
+var ErrUnsupportedStruct = errors.New("merlin: unable to append struct")
+
+// Add exported fields of the struct v, or of the struct v points to,
+// in declaration order. Every exported field must have a `merlin:"label"` tag,
+// `merlin:"-"` skips the field, unexported fields are ignored.
+// Fields are appended with the typed helpers:
+//
+//	bool                          AppendBool
+//	int, int8, ..., int64         AppendI64
+//	uint, uint8, ..., uint64      AppendU64
+//	string                        AppendString
+//	[]byte, [N]byte               AppendMessage
+//	*big.Int                      AppendBigInt
+//	encoding.BinaryMarshaler      AppendBinaryMarshaler
+//	Bytes() []byte, e.g. Element  AppendMessage of Bytes()
+//	struct                        its fields labeled "label.field", at least one
+//	slice                         AppendU64 of its length, then every item with the label
+//	array                         every item with the label
+//	pointer, interface            the value it refers to, nil is an error
+//
+// Returns an error wrapping ErrUnsupportedStruct for untagged fields, unsupported
+// types, structs without fields to append, e.g. big.Int held by value or
+// sync.Mutex, and nil values, the transcript is left untouched on any error then.
+// Returns ErrDestroyed if the transcript is destroyed.
+// The plan of appends is computed once per type and cached
+func AppendStruct(t *Transcript, v interface{}) error {
+	if t.strobe.Destroyed() {
+		return ErrDestroyed
+	}
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return fmt.Errorf("%w: %T isn't a struct", ErrUnsupportedStruct, v)
+	}
+	fields, err := structPlan(rv.Type())
+	if err != nil {
+		return err
+	}
+
+	// fields are appended to a copy, which replaces t on success
+	var ops Recording
+	c := &Transcript{strobe: t.strobe.Clone()}
+	if t.recorder != nil {
+		c.recorder = &ops
+	}
+	for _, f := range fields {
+		if err := f.enc(c, f.label, rv.Field(f.index)); err != nil {
+			return err
+		}
+	}
+	t.strobe = c.strobe
+	for _, op := range ops {
+		t.recorder.Record(op)
+	}
+	return nil
+}
+
+type encoderFunc func(t *Transcript, label string, v reflect.Value) error
+
+type field struct {
+	index int
+	label string
+	enc   encoderFunc
+}
+
+type cachedEncoder struct {
+	enc encoderFunc
+	err error
+}
+
+type cachedPlan struct {
+	fields []field
+	err    error
+}
+
+var (
+	encoderCache sync.Map // map[reflect.Type]cachedEncoder
+	planCache    sync.Map // map[reflect.Type]cachedPlan
+
+	bigIntType    = reflect.TypeOf((*big.Int)(nil))
+	bigIntValue   = bigIntType.Elem()
+	marshalerType = reflect.TypeOf((*encoding.BinaryMarshaler)(nil)).Elem()
+	byteSliceType = reflect.TypeOf([]byte(nil))
+	bytesType     = reflect.TypeOf((*interface{ Bytes() []byte })(nil)).Elem()
+)
+
+func structPlan(typ reflect.Type) ([]field, error) {
+	if p, ok := planCache.Load(typ); ok {
+		return p.(cachedPlan).fields, p.(cachedPlan).err
+	}
+	fields, err := newStructPlan(typ)
+	planCache.Store(typ, cachedPlan{fields, err})
+	return fields, err
+}
+
+func newStructPlan(typ reflect.Type) ([]field, error) {
+	var fields []field
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		if f.PkgPath != "" {
+			continue // unexported
+		}
+		label, ok := f.Tag.Lookup("merlin")
+		if label == "-" {
+			continue
+		}
+		if !ok || label == "" {
+			return nil, fmt.Errorf("%w: field %s.%s has no merlin tag", ErrUnsupportedStruct, typ, f.Name)
+		}
+		enc, err := typeEncoder(f.Type)
+		if err != nil {
+			return nil, fmt.Errorf("%w (field %s.%s)", err, typ, f.Name)
+		}
+		fields = append(fields, field{i, label, enc})
+	}
+	// otherwise values of the type would be appended as nothing
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("%w: %s has no fields to append", ErrUnsupportedStruct, typ)
+	}
+	return fields, nil
+}
+
+func typeEncoder(typ reflect.Type) (encoderFunc, error) {
+	if e, ok := encoderCache.Load(typ); ok {
+		return e.(cachedEncoder).enc, e.(cachedEncoder).err
+	}
+	enc, err := newTypeEncoder(typ)
+	encoderCache.Store(typ, cachedEncoder{enc, err})
+	return enc, err
+}
+
+func newTypeEncoder(typ reflect.Type) (encoderFunc, error) {
+	// special types go first, e.g. *big.Int is a pointer with Bytes method
+	switch {
+	case typ == bigIntType:
+		return nonNil(bigIntEncoder), nil
+	case typ == bigIntValue:
+		return nil, fmt.Errorf("%w: big.Int must be held by pointer", ErrUnsupportedStruct)
+	case typ == byteSliceType || typ.Kind() == reflect.Slice && typ.Elem().Kind() == reflect.Uint8:
+		return bytesEncoder, nil
+	case typ.Kind() == reflect.Array && typ.Elem().Kind() == reflect.Uint8:
+		return byteArrayEncoder, nil
+	case typ.Implements(marshalerType):
+		return nonNil(marshalerEncoder), nil
+	case typ.Implements(bytesType):
+		return nonNil(bytesMethodEncoder), nil
+	}
+
+	switch typ.Kind() {
+	case reflect.Bool:
+		return boolEncoder, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return intEncoder, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return uintEncoder, nil
+	case reflect.String:
+		return stringEncoder, nil
+	case reflect.Struct:
+		fields, err := structPlan(typ)
+		if err != nil {
+			return nil, err
+		}
+		return structEncoder(fields), nil
+	case reflect.Slice:
+		return sliceEncoder(typ.Elem(), true), nil
+	case reflect.Array:
+		return sliceEncoder(typ.Elem(), false), nil
+	case reflect.Ptr:
+		return nonNil(indirectEncoder(typ.Elem())), nil
+	case reflect.Interface:
+		return nonNil(dynamicEncoder), nil
+	}
+	return nil, fmt.Errorf("%w: unsupported type %s", ErrUnsupportedStruct, typ)
+}
+
+func nonNil(enc encoderFunc) encoderFunc {
+	return func(t *Transcript, label string, v reflect.Value) error {
+		switch v.Kind() {
+		case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+			if v.IsNil() {
+				return fmt.Errorf("%w: %s is nil", ErrUnsupportedStruct, label)
+			}
+		}
+		return enc(t, label, v)
+	}
+}
+
+func boolEncoder(t *Transcript, label string, v reflect.Value) error {
+	t.AppendBool([]byte(label), v.Bool())
+	return nil
+}
+
+func intEncoder(t *Transcript, label string, v reflect.Value) error {
+	t.AppendI64([]byte(label), v.Int())
+	return nil
+}
+
+func uintEncoder(t *Transcript, label string, v reflect.Value) error {
+	t.AppendU64([]byte(label), v.Uint())
+	return nil
+}
+
+func stringEncoder(t *Transcript, label string, v reflect.Value) error {
+	return t.TryAppendMessage([]byte(label), []byte(v.String()))
+}
+
+func bytesEncoder(t *Transcript, label string, v reflect.Value) error {
+	return t.TryAppendMessage([]byte(label), v.Bytes())
+}
+
+func byteArrayEncoder(t *Transcript, label string, v reflect.Value) error {
+	// not reflect.Copy, the items may be of a named byte type
+	data := make([]byte, v.Len())
+	for i := range data {
+		data[i] = byte(v.Index(i).Uint())
+	}
+	return t.TryAppendMessage([]byte(label), data)
+}
+
+func bigIntEncoder(t *Transcript, label string, v reflect.Value) error {
+	t.AppendBigInt([]byte(label), v.Interface().(*big.Int))
+	return nil
+}
+
+func marshalerEncoder(t *Transcript, label string, v reflect.Value) error {
+	return t.AppendBinaryMarshaler([]byte(label), v.Interface().(encoding.BinaryMarshaler))
+}
+
+func bytesMethodEncoder(t *Transcript, label string, v reflect.Value) error {
+	return t.TryAppendMessage([]byte(label), v.Interface().(interface{ Bytes() []byte }).Bytes())
+}
+
+func structEncoder(fields []field) encoderFunc {
+	return func(t *Transcript, label string, v reflect.Value) error {
+		for _, f := range fields {
+			if err := f.enc(t, label+"."+f.label, v.Field(f.index)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// Item encoders are resolved on the first use, so recursive types are supported
+func sliceEncoder(item reflect.Type, prefix bool) encoderFunc {
+	return func(t *Transcript, label string, v reflect.Value) error {
+		enc, err := typeEncoder(item)
+		if err != nil {
+			return err
+		}
+		if prefix {
+			t.AppendU64([]byte(label), uint64(v.Len()))
+		}
+		for i := 0; i < v.Len(); i++ {
+			if err := enc(t, label, v.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func indirectEncoder(elem reflect.Type) encoderFunc {
+	return func(t *Transcript, label string, v reflect.Value) error {
+		enc, err := typeEncoder(elem)
+		if err != nil {
+			return err
+		}
+		return enc(t, label, v.Elem())
+	}
+}
+
+func dynamicEncoder(t *Transcript, label string, v reflect.Value) error {
+	enc, err := typeEncoder(v.Elem().Type())
+	if err != nil {
+		return err
+	}
+	return enc(t, label, v.Elem())
+}
@@ -0,0 +1,190 @@
+// Copyright © 2019. Sergey Skaredov.
+// Licensed under the MIT License.
+// See LICENSE.txt for details.
+
+package merlin
+
+import (
+	"github.com/skoret/merlin/strobe"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+)
+
+type commitment struct {
+	Point  Element `merlin:"point"`
+	Hiding bool    `merlin:"hiding"`
+}
+
+type namedByte uint8
+
+type proofMessage struct {
+	Version     uint8        `merlin:"version"`
+	Round       int32        `merlin:"round"`
+	Name        string       `merlin:"name"`
+	Nonce       [4]byte      `merlin:"nonce"`
+	Payload     []byte       `merlin:"payload"`
+	Value       *big.Int     `merlin:"value"`
+	Time        time.Time    `merlin:"time"`
+	Commitments []commitment `merlin:"commitments"`
+	Weights     [2]uint16    `merlin:"weights"`
+	Last        *commitment  `merlin:"last"`
+	Digest      [2]namedByte `merlin:"digest"`
+	Tail        []namedByte  `merlin:"tail"`
+	Ignored     float64      `merlin:"-"`
+	cache       map[string]int
+}
+
+func TestAppendStruct(t *testing.T) {
+	g := testGroup()
+	now := time.Unix(239, 0).UTC()
+	msg := proofMessage{
+		Version: 1,
+		Round:   -3,
+		Name:    "proof",
+		Nonce:   [4]byte{1, 2, 3, 4},
+		Payload: []byte("payload"),
+		Value:   big.NewInt(-239),
+		Time:    now,
+		Commitments: []commitment{
+			{g.Generator(), true},
+			{g.Identity(), false},
+		},
+		Weights: [2]uint16{7, 9},
+		Last:    &commitment{g.Generator(), false},
+		Digest:  [2]namedByte{5, 6},
+		Tail:    []namedByte{7, 8, 9},
+		Ignored: 2.39,
+	}
+
+	t1, t2 := NewTranscript("test protocol"), NewTranscript("test protocol")
+	assert.NoError(t, AppendStruct(t1, &msg))
+
+	appendManually := func(prefix string, m *proofMessage) {
+		t2.AppendU64([]byte(prefix+"version"), uint64(m.Version))
+		t2.AppendI64([]byte(prefix+"round"), int64(m.Round))
+		t2.AppendString([]byte(prefix+"name"), m.Name)
+		t2.AppendMessage([]byte(prefix+"nonce"), m.Nonce[:])
+		t2.AppendMessage([]byte(prefix+"payload"), m.Payload)
+		t2.AppendBigInt([]byte(prefix+"value"), m.Value)
+		assert.NoError(t, t2.AppendBinaryMarshaler([]byte(prefix+"time"), m.Time))
+		t2.AppendU64([]byte(prefix+"commitments"), uint64(len(m.Commitments)))
+		for _, c := range m.Commitments {
+			t2.AppendPoint([]byte(prefix+"commitments.point"), c.Point)
+			t2.AppendBool([]byte(prefix+"commitments.hiding"), c.Hiding)
+		}
+		t2.AppendU64([]byte(prefix+"weights"), uint64(m.Weights[0]))
+		t2.AppendU64([]byte(prefix+"weights"), uint64(m.Weights[1]))
+		t2.AppendPoint([]byte(prefix+"last.point"), m.Last.Point)
+		t2.AppendBool([]byte(prefix+"last.hiding"), m.Last.Hiding)
+		t2.AppendMessage([]byte(prefix+"digest"), []byte{byte(m.Digest[0]), byte(m.Digest[1])})
+		tail := make([]byte, len(m.Tail))
+		for i, b := range m.Tail {
+			tail[i] = byte(b)
+		}
+		t2.AppendMessage([]byte(prefix+"tail"), tail)
+	}
+	appendManually("", &msg)
+
+	// nested struct labels are joined with dots
+	type outer struct {
+		Message proofMessage `merlin:"message"`
+	}
+	assert.NoError(t, AppendStruct(t1, outer{msg}))
+	appendManually("message.", &msg)
+
+	assertTranscripts(t, t1, t2)
+}
+
+func TestAppendStructErrors(t *testing.T) {
+	type untagged struct {
+		Tagged   int `merlin:"tagged"`
+		Untagged int
+	}
+	type emptyTag struct {
+		Field int `merlin:""`
+	}
+	type unsupported struct {
+		Field map[string]int `merlin:"field"`
+	}
+	type nested struct {
+		Inner untagged `merlin:"inner"`
+	}
+	type nilPointer struct {
+		Tagged  int      `merlin:"tagged"`
+		Pointer *int     `merlin:"pointer"`
+		Value   *big.Int `merlin:"value"`
+	}
+	type nilInterface struct {
+		Tagged    int         `merlin:"tagged"`
+		Interface interface{} `merlin:"interface"`
+	}
+	type dynamic struct {
+		Interface interface{} `merlin:"interface"`
+	}
+	type bigIntValue struct {
+		Value big.Int `merlin:"value"`
+	}
+	type noFields struct {
+		Mutex sync.Mutex `merlin:"mutex"`
+	}
+	type skipped struct {
+		Value int `merlin:"-"`
+	}
+
+	for _, v := range []interface{}{
+		untagged{},
+		&emptyTag{},
+		unsupported{},
+		nested{},
+		nilPointer{},
+		nilPointer{Pointer: new(int)},
+		nilInterface{},
+		dynamic{[]float32{1}},
+		&bigIntValue{},
+		dynamic{*big.NewInt(5)},
+		&noFields{},
+		skipped{},
+		42,
+		(*nested)(nil),
+		nil,
+	} {
+		tr := NewTranscript("test protocol")
+		err := AppendStruct(tr, v)
+		assert.ErrorIs(t, err, ErrUnsupportedStruct, "%T", v)
+
+		// the transcript is left untouched
+		assertTranscripts(t, tr, NewTranscript("test protocol"))
+	}
+
+	// cached plans give the same errors
+	assert.ErrorIs(t, AppendStruct(NewTranscript("test protocol"), untagged{}), ErrUnsupportedStruct)
+
+	t1, t2 := NewTranscript("test protocol"), NewTranscript("test protocol")
+	assert.NoError(t, AppendStruct(t1, dynamic{"value"}))
+	t2.AppendString([]byte("interface"), "value")
+	assertTranscripts(t, t1, t2)
+
+	destroyed := NewTranscript("test protocol")
+	destroyed.Destroy()
+	assert.ErrorIs(t, AppendStruct(destroyed, dynamic{"value"}), strobe.ErrDestroyed)
+}
+
+func BenchmarkAppendStruct(b *testing.B) {
+	msg := proofMessage{
+		Name:        "proof",
+		Payload:     make([]byte, 64),
+		Value:       big.NewInt(239),
+		Commitments: []commitment{{testGroup().Generator(), true}},
+		Last:        &commitment{testGroup().Identity(), false},
+	}
+	b.ReportAllocs()
+	tr := NewTranscript("test protocol")
+	for i := 0; i < b.N; i++ {
+		if err := AppendStruct(tr, &msg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
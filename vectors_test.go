@@ -0,0 +1,158 @@
+// Copyright © 2019. Sergey Skaredov.
+// Licensed under the MIT License.
+// See LICENSE.txt for details.
+
+package merlin
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Vectors live in testdata/ as JSON: *_vectors.json are known answers published
+// by other implementations, *_regression.json are outputs of this implementation
+// kept to detect changes, see testdata/README.md.
+// Every vector is a sequence of operations run on a transcript labeled with vector's label:
+//
+//	append           AD of data (text), hex (bytes) or length bytes of fill
+//	challenge        PRF of length bytes, compared to expected if present
+//	append_challenge AD of the last challenge
+//	check            compare the last challenge or rng output to expected
+//	repeat           run ops count times
+//	ratchet          RATCHET of the transcript or, after finalize, of the rng
+//	rekey            KEY of the witness given as append data, builds rng first
+//	finalize         finalize rng with the entropy given in hex
+//	read             read length bytes from rng, compared to expected if present
+type vector struct {
+	Name   string     `json:"name"`
+	Source string     `json:"source"`
+	Label  string     `json:"label"`
+	Ops    []vectorOp `json:"ops"`
+}
+
+type vectorOp struct {
+	Op       string     `json:"op"`
+	Label    string     `json:"label"`
+	Data     string     `json:"data"`
+	Hex      string     `json:"hex"`
+	Fill     byte       `json:"fill"`
+	Length   int        `json:"length"`
+	Count    int        `json:"count"`
+	Ops      []vectorOp `json:"ops"`
+	Expected string     `json:"expected"`
+}
+
+func (op *vectorOp) bytes(t *testing.T) []byte {
+	switch {
+	case op.Hex != "":
+		data, err := hex.DecodeString(op.Hex)
+		if err != nil {
+			t.Fatalf("invalid hex %q: %v", op.Hex, err)
+		}
+		return data
+	case op.Length > 0:
+		return bytes.Repeat([]byte{op.Fill}, op.Length)
+	default:
+		return []byte(op.Data)
+	}
+}
+
+// State of a vector run
+type vectorRun struct {
+	transcript *Transcript
+	builder    *TranscriptRngBuilder
+	rng        *TranscriptRng
+	last       []byte
+}
+
+func (r *vectorRun) run(t *testing.T, ops []vectorOp) {
+	for i := range ops {
+		op := &ops[i]
+		switch op.Op {
+		case "append":
+			r.transcript.AppendMessage([]byte(op.Label), op.bytes(t))
+		case "challenge":
+			r.last = make([]byte, op.Length)
+			r.transcript.ChallengeBytes([]byte(op.Label), r.last)
+			r.check(t, op)
+		case "append_challenge":
+			r.transcript.AppendMessage([]byte(op.Label), r.last)
+		case "check":
+			r.check(t, op)
+		case "repeat":
+			for j := 0; j < op.Count; j++ {
+				r.run(t, op.Ops)
+			}
+		case "ratchet":
+			if r.rng != nil {
+				r.rng.Ratchet()
+			} else {
+				r.transcript.Ratchet([]byte(op.Label))
+			}
+		case "rekey":
+			if r.builder == nil {
+				r.builder = r.transcript.BuildRng()
+			}
+			r.builder.RekeyWithWitness([]byte(op.Label), op.bytes(t))
+		case "finalize":
+			if r.builder == nil {
+				r.builder = r.transcript.BuildRng()
+			}
+			r.rng = r.builder.Finalize(bytes.NewReader(op.bytes(t)))
+		case "read":
+			r.last = make([]byte, op.Length)
+			if _, err := r.rng.Read(r.last); err != nil {
+				t.Fatalf("unable to read from rng: %v", err)
+			}
+			r.check(t, op)
+		default:
+			t.Fatalf("unknown operation %q", op.Op)
+		}
+	}
+}
+
+func (r *vectorRun) check(t *testing.T, op *vectorOp) {
+	if op.Expected != "" {
+		assert.Equal(t, op.Expected, hex.EncodeToString(r.last), "operation %q %q", op.Op, op.Label)
+	}
+}
+
+func TestVectors(t *testing.T) {
+	runVectors(t, "*_vectors.json")
+}
+
+func TestRegression(t *testing.T) {
+	runVectors(t, "*_regression.json")
+}
+
+func runVectors(t *testing.T, pattern string) {
+	files, err := filepath.Glob(filepath.Join("testdata", pattern))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NotEmpty(t, files)
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var vectors []vector
+		if err := json.Unmarshal(data, &vectors); err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+
+		for _, v := range vectors {
+			v := v
+			t.Run(filepath.Base(file)+"/"+v.Name, func(t *testing.T) {
+				r := vectorRun{transcript: NewTranscript(v.Label)}
+				r.run(t, v.Ops)
+			})
+		}
+	}
+}